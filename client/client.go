@@ -2,225 +2,560 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
 )
 
+// Client reads and writes the register by talking to the nodes directly.
+// It is safe for concurrent use.
 type Client struct {
-	Server          *http.Server
-	ID              string
-	Port            int
-	NumNodes        int
-	QuorumThreshold int
-	NodePorts       []string
-	httpClient      http.Client
+	ID       string
+	NumNodes int
+	// NumReplicas is how many nodes each address is replicated to. It must match the nodes'.
+	NumReplicas int
+	// Nodes are the addresses of every node, in order of node ID
+	Nodes      []string
+	httpClient http.Client
+
+	// ReadQuorum and WriteQuorum are the default quorums for reads and for each phase of a write.
+	// They can be overridden per request.
+	ReadQuorum  Quorum
+	WriteQuorum Quorum
+
+	// writeSeq numbers this client's writes. Write IDs are the client ID and the sequence number.
+	writeSeq atomic.Uint64
+	// clock timestamps the writes this client commits, and is exchanged with the nodes on every request
+	clock *shared.Clock
+
+	recoveryStop chan struct{}
+	// stragglers tracks the repairs, confirms and aborts still running for replicas that
+	// responded after a request returned
+	stragglers sync.WaitGroup
 }
 
-func New(port int, numNodes int, firstNodePort int) *Client {
+// New creates a client for the given nodes, in order of node ID.
+// Nodes are addresses, either host:port or a URL such as http://host:port.
+// Unlike Dial, the configuration isn't validated.
+func New(nodes []string, opts ...Option) *Client {
 	c := &Client{
-		ID:              uuid.NewString(),
-		Port:            port,
-		NumNodes:        numNodes,
-		QuorumThreshold: numNodes/2 + 1,
+		ID:          uuid.NewString(),
+		NumNodes:    len(nodes),
+		NumReplicas: len(nodes),
+		Nodes:       nodes,
 		httpClient: http.Client{
-			Timeout: 3 * time.Second,
+			// Each client pools its own connections, so Close can release them. Otherwise a node
+			// restarted on the same address would be sent requests on connections it closed.
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   3 * time.Second,
 		},
+		ReadQuorum:  QuorumMajority,
+		WriteQuorum: QuorumMajority,
+		clock:       shared.NewClock(),
 	}
 
-	nodePorts := make([]string, numNodes)
-	nodePorts[0] = fmt.Sprintf("%d", firstNodePort)
-	for i := 1; i < numNodes; i++ {
-		nodePorts[i] = fmt.Sprintf("%d", firstNodePort+i)
+	for _, opt := range opts {
+		opt(c)
 	}
+	checkQuorums(c.ReadQuorum, c.WriteQuorum, c.NumReplicas)
 
-	c.NodePorts = nodePorts
 	return c
 }
 
+// Close stops recovery, waits for work on stragglers to finish, and closes idle connections to the nodes
+func (c *Client) Close() error {
+	c.StopRecovery()
+	c.stragglers.Wait()
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// background runs fn in its own goroutine, tracked so Close can wait for it
+func (c *Client) background(fn func()) {
+	c.stragglers.Add(1)
+	go func() {
+		defer c.stragglers.Done()
+		fn()
+	}()
+}
+
+// replicaNodes returns the nodes of the nodes addr is replicated to.
+// Quorums are counted against these nodes rather than the whole cluster.
+func (c *Client) replicaNodes(addr string) []string {
+	var nodes []string
+	for _, shard := range shared.ReplicaShards(addr, c.NumNodes, c.NumReplicas) {
+		nodes = append(nodes, c.Nodes[shard])
+	}
+	return nodes
+}
+
 type readResult struct {
 	ValueVersion      shared.ValueVersion
 	NodeShouldInclude bool
-	Port              string
+	Node              string
 	Err               error
+	Start             time.Time
 }
 
-func (c *Client) Read(addr string) (shared.ValueVersion, error) {
-	ch := make(chan readResult)
+// Consistency is the guarantee a read makes about the value it returns
+type Consistency string
+
+const (
+	// ConsistencyRegular returns the latest value seen by a quorum, and repairs out of date
+	// nodes on a best effort basis. A later read can still return an older value if the
+	// repairs didn't reach a quorum.
+	ConsistencyRegular Consistency = "regular"
+	// ConsistencyLinearizable only returns once the value has been written back to a quorum,
+	// so every later read returns it or something newer
+	ConsistencyLinearizable Consistency = "linearizable"
+)
 
-	// Read from the nodes in parallel
-	for _, port := range c.NodePorts {
-		port := port
-		go func(port string) {
-			vv, shouldInclude, err := c.readFromNode(addr, port)
-			ch <- readResult{ValueVersion: vv, NodeShouldInclude: shouldInclude, Port: port, Err: err}
-		}(port)
+func ParseConsistency(s string) (Consistency, error) {
+	switch Consistency(s) {
+	case "", ConsistencyRegular:
+		return ConsistencyRegular, nil
+	case ConsistencyLinearizable:
+		return ConsistencyLinearizable, nil
 	}
 
-	// Collect the results
-	var readRes []readResult
-	for i := 0; i < len(c.NodePorts); i++ {
-		res := <-ch
+	return "", fmt.Errorf("Invalid consistency %s", s)
+}
+
+// ReadOptions overrides the client's defaults for a single read
+type ReadOptions struct {
+	// Consistency defaults to ConsistencyRegular
+	Consistency Consistency
+	// Quorum defaults to the client's ReadQuorum
+	Quorum Quorum
+}
+
+func (c *Client) Read(ctx context.Context, addr string) (shared.ValueVersion, error) {
+	return c.ReadWithOptions(ctx, addr, ReadOptions{})
+}
+
+func (c *Client) ReadWithOptions(ctx context.Context, addr string, opts ReadOptions) (shared.ValueVersion, error) {
+	// A smaller read quorum that doesn't overlap the write quorum is the caller's choice to make,
+	// but one that can't be reached is a mistake
+	readQuorum := c.ReadQuorum
+	if opts.Quorum != "" {
+		q, err := validQuorum("read", opts.Quorum, c.NumReplicas)
+		if err != nil {
+			return shared.ValueVersion{}, shared.BadRequest("%s", err)
+		}
+		readQuorum = q
+	}
+
+	replicas := c.replicaNodes(addr)
+	readThreshold := readQuorum.Threshold(len(replicas))
+	writeThreshold := c.WriteQuorum.Threshold(len(replicas))
+
+	// A linearizable read writes back to a write quorum, and only counts the replicas it read
+	// from, so it waits for a write quorum of them even if the read quorum is smaller
+	need := readThreshold
+	if opts.Consistency == ConsistencyLinearizable && writeThreshold > need {
+		need = writeThreshold
+	}
+
+	// Read from the replicas in parallel, until enough of them respond
+	readRes, late := quorumCall(replicas, need, func(node string) readResult {
+		start := time.Now()
+		vv, shouldInclude, err := c.readFromNode(ctx, addr, node)
+		return readResult{ValueVersion: vv, NodeShouldInclude: shouldInclude, Node: node, Err: err, Start: start}
+	}, func(res readResult) bool {
+		return res.Err == nil && res.NodeShouldInclude
+	})
+
+	var nodeResults []NodeResult
+	for _, res := range readRes {
 		if res.Err != nil {
-			log.Printf("Error reading from node %s: %s", res.Port, res.Err)
+			log.Printf("Error reading from node %s: %s", res.Node, res.Err)
 		}
-		// TODO: don't wait for all reads to complete
-		readRes = append(readRes, res)
+		nodeResults = append(nodeResults, newNodeResult(res.Node, res.Start, res.ValueVersion.Version, res.NodeShouldInclude, res.Err))
 	}
+	recordPhase(ctx, Phase{Name: "read", Nodes: noResponse(replicas, nodeResults)})
 
 	// Determining what version to return
-	var currentValue *string
-	var latestVersion *int
+	var latest *shared.ValueVersion
 	validResponses := 0
+	notFound := 0
 	for _, res := range readRes {
-		if res.Err != nil {
+		if errors.Is(res.Err, shared.ErrNotFound) {
+			notFound++
+			continue
+		} else if res.Err != nil {
 			continue
 		} else if !res.NodeShouldInclude {
-			log.Printf("Node on port %s doesn't accept read to address %s", res.Port, addr)
+			log.Printf("Node %s doesn't accept read to address %s", res.Node, addr)
 			continue
 		}
 
 		validResponses++
-		value := res.ValueVersion.Value
-		version := res.ValueVersion.Version
-		if currentValue == nil || res.ValueVersion.Version > *latestVersion {
-			currentValue = &value
-			latestVersion = &version
+		vv := res.ValueVersion
+		if latest == nil || vv.Newer(*latest) {
+			latest = &vv
 		}
 	}
 
-	if validResponses < c.QuorumThreshold {
-		return shared.ValueVersion{}, fmt.Errorf("Not enough valid responses to make quorum")
+	// The address is missing rather than unavailable if a quorum of replicas doesn't have it
+	if validResponses == 0 && notFound >= readThreshold {
+		return shared.ValueVersion{}, shared.NotFound("Address %s not found", addr)
+	}
+	if validResponses < readThreshold {
+		return shared.ValueVersion{}, shared.QuorumFailed("Not enough valid responses to make quorum")
 	}
 
-	log.Printf("Client %s read address %s with value %s and version %d", c.ID, addr, *currentValue, *latestVersion)
+	log.Printf("Client %s read address %s with value %s and version %d from write %s", c.ID, addr, latest.Value, latest.Version, latest.WriteID)
+
+	// Nodes that respond after the quorum are repaired in the background, after ctx may be done
+	c.background(func() { c.repairLate(addr, *latest, late) })
 
 	// Update nodes that were behind
 	// Now that we know the latest version and value, we simply iterate through the read responses
-	// again and update the nodes that either errored or had an out of date version
+	// again and update the nodes that either errored or had an out of date version. A node with
+	// the latest version from a different write is out of date too.
+	//
+	// Replicas that already had the latest version, or that were updated to it, count towards
+	// the write back quorum. Nodes that errored are most likely replicas missing the address.
 	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	writtenBack := 0
+	repair := Phase{Name: "repair"}
 	for _, res := range readRes {
 		res := res
 
-		if res.Err != nil || res.ValueVersion.Version != *latestVersion {
+		if res.Err != nil || res.ValueVersion != *latest {
 			wg.Add(1)
-			go func(port string) {
+			go func(node string) {
 				defer wg.Done()
-				if err := c.updateNode(addr, *currentValue, *latestVersion, port); err != nil {
-					log.Printf("Error updating node %s: %s", port, err)
+				start := time.Now()
+				// A node that moved past latestVersion since it was read ignores the update
+				updateRes, err := c.updateNode(ctx, addr, *latest, node)
+
+				mu.Lock()
+				defer mu.Unlock()
+				repair.Nodes = append(repair.Nodes, newNodeResult(node, start, updateRes.Version, true, err))
+				if err != nil {
+					log.Printf("Error updating node %s: %s", node, err)
+					return
+				}
+
+				if res.Err != nil || res.NodeShouldInclude {
+					writtenBack++
 				}
-			}(res.Port)
+			}(res.Node)
+		} else if res.NodeShouldInclude {
+			mu.Lock()
+			writtenBack++
+			mu.Unlock()
 		}
 	}
 
 	wg.Wait()
+	if len(repair.Nodes) > 0 {
+		recordPhase(ctx, repair)
+	}
 
-	return shared.ValueVersion{
-		Value:   *currentValue,
-		Version: *latestVersion,
-	}, nil
+	// The write back is a write, so it needs the write quorum for later reads to see it
+	if opts.Consistency == ConsistencyLinearizable && writtenBack < writeThreshold {
+		return shared.ValueVersion{}, shared.QuorumFailed("Writing back version %d to quorum not reached, try again later", latest.Version)
+	}
+
+	return *latest, nil
+}
+
+// repairLate updates the nodes that responded to a read of addr after it returned,
+// if they are behind the value the read returned
+func (c *Client) repairLate(addr string, vv shared.ValueVersion, late <-chan readResult) {
+	for res := range late {
+		if res.Err == nil && !vv.Newer(res.ValueVersion) {
+			continue
+		}
+
+		if _, err := c.updateNode(context.Background(), addr, vv, res.Node); err != nil {
+			log.Printf("Error updating node %s: %s", res.Node, err)
+		}
+	}
+}
+
+// WriteOptions overrides the client's defaults for a single write
+type WriteOptions struct {
+	// Quorum defaults to the client's WriteQuorum
+	Quorum Quorum
+}
+
+func (c *Client) Write(ctx context.Context, addr string, val string) error {
+	return c.WriteWithOptions(ctx, addr, val, WriteOptions{})
 }
 
-func (c *Client) Write(addr string, val string) error {
-	if err := c.write(addr, val); err != nil {
+func (c *Client) WriteWithOptions(ctx context.Context, addr string, val string, opts WriteOptions) error {
+	writeQuorum := c.WriteQuorum
+	if opts.Quorum != "" {
+		q, err := validQuorum("write", opts.Quorum, c.NumReplicas)
+		if err != nil {
+			return shared.BadRequest("%s", err)
+		}
+		writeQuorum = q
+	}
+
+	return c.writeAndConfirm(ctx, addr, val, nil, writeQuorum)
+}
+
+// CompareAndSwap writes val to addr only if the address is currently at expectedVersion.
+// An address that has never been written to is at version 0.
+// If the address is at a newer version, a *shared.ConflictError with the observed version is returned.
+func (c *Client) CompareAndSwap(ctx context.Context, addr string, expectedVersion int, val string) error {
+	return c.writeAndConfirm(ctx, addr, val, &expectedVersion, c.WriteQuorum)
+}
+
+// writeAndConfirm runs both phases of a write on addr's replicas, each of which needs quorum acks.
+// Aborts still go out if ctx is done, since they clean up after the write.
+func (c *Client) writeAndConfirm(ctx context.Context, addr string, val string, expectedVersion *int, quorum Quorum) error {
+	writeID := c.nextWriteID()
+	replicas := c.replicaNodes(addr)
+	threshold := quorum.Threshold(len(replicas))
+
+	acked, lateWrites, err := c.write(ctx, addr, val, writeID, expectedVersion, replicas, threshold)
+	if err != nil {
+		// Clear the pre-commits that did go through, so other writers don't have to wait
+		// for them to time out
+		c.abort(cleanupContext(ctx), addr, writeID, acked)
+		c.background(func() { c.resolveLate(addr, writeID, lateWrites, c.abortWithNode) })
 		return err
 	}
 
+	// The clock has seen every replica that acked the pre-commit, so the commit timestamp comes
+	// after everything they had stored
+	ts := c.clock.Now()
+	confirmWithNode := func(ctx context.Context, addr string, writeID string, node string) error {
+		return c.confirmWithNode(ctx, addr, writeID, ts, node)
+	}
+
 	// OPTIMIZATION: Only send confirmations to nodes that acked the write
-	return c.confirm(addr)
+	confirmed, err := c.confirm(ctx, addr, writeID, confirmWithNode, replicas, threshold)
+	if err != nil {
+		isConfirmed := make(map[string]bool)
+		for _, node := range confirmed {
+			isConfirmed[node] = true
+		}
+
+		var unconfirmed []string
+		for _, node := range acked {
+			if !isConfirmed[node] {
+				unconfirmed = append(unconfirmed, node)
+			}
+		}
+		c.abort(cleanupContext(ctx), addr, writeID, unconfirmed)
+		c.background(func() { c.resolveLate(addr, writeID, lateWrites, c.abortWithNode) })
+		return err
+	}
+
+	// A pre-commit that lands after its confirm would otherwise stay pending until recovered
+	c.background(func() { c.resolveLate(addr, writeID, lateWrites, confirmWithNode) })
+
+	return nil
+}
+
+func (c *Client) nextWriteID() string {
+	return fmt.Sprintf("%s-%d", c.ID, c.writeSeq.Add(1))
 }
 
 type writeResult struct {
 	NodeShouldInclude bool
+	Node              string
 	Err               error
+	Start             time.Time
 }
 
-func (c *Client) write(addr string, val string) error {
-	log.Printf("Attempting to write value %s to address %s\n", val, addr)
+func (res writeResult) ok() bool {
+	return res.Err == nil && res.NodeShouldInclude
+}
+
+// write pre-commits val to addr on the replicas, returning the nodes of the nodes that accepted it
+// once it reaches quorum or can't. Results from the remaining replicas are sent on the returned channel.
+func (c *Client) write(ctx context.Context, addr string, val string, writeID string, expectedVersion *int, replicas []string, threshold int) ([]string, <-chan writeResult, error) {
+	log.Printf("Attempting to write value %s to address %s for write %s\n", val, addr, writeID)
 	// First write, then confirm
-	writeCh := make(chan writeResult)
 
-	// Write to the nodes in parallel
-	for _, port := range c.NodePorts {
-		port := port
-		go func(port string) {
-			shouldInclude, err := c.writeToNode(addr, val, port)
-			writeCh <- writeResult{NodeShouldInclude: shouldInclude, Err: err}
-		}(port)
-	}
+	// Write to the replicas in parallel
+	results, late := quorumCall(replicas, threshold, func(node string) writeResult {
+		start := time.Now()
+		shouldInclude, err := c.writeToNode(ctx, addr, val, writeID, expectedVersion, node)
+		return writeResult{NodeShouldInclude: shouldInclude, Node: node, Err: err, Start: start}
+	}, writeResult.ok)
 
 	// Collect the results
-	numSuccessWrites := 0
-	for i := 0; i < len(c.NodePorts); i++ {
-		// TODO: don't wait for all writes to complete
-		res := <-writeCh
-		if res.Err != nil {
-			log.Printf("Error writing to node on port %s: %s", c.NodePorts[i], res.Err)
+	var acked []string
+	var conflict *shared.ConflictError
+	var nodeResults []NodeResult
+	for _, res := range results {
+		nodeResults = append(nodeResults, newNodeResult(res.Node, res.Start, 0, res.NodeShouldInclude, res.Err))
+
+		var nodeConflict *shared.ConflictError
+		if errors.As(res.Err, &nodeConflict) {
+			log.Printf("Node %s is at version %d, expected version %d", res.Node, nodeConflict.ObservedVersion, nodeConflict.ExpectedVersion)
+			if conflict == nil || nodeConflict.ObservedVersion > conflict.ObservedVersion {
+				conflict = nodeConflict
+			}
+		} else if res.Err != nil {
+			log.Printf("Error writing to node %s: %s", res.Node, res.Err)
 		} else if !res.NodeShouldInclude {
-			log.Printf("Node on port %s doesn't accept write to address %s", c.NodePorts[i], addr)
+			log.Printf("Node %s doesn't accept write to address %s", res.Node, addr)
 		} else {
-			numSuccessWrites++
+			acked = append(acked, res.Node)
 		}
 	}
+	recordPhase(ctx, Phase{Name: "write", Nodes: noResponse(replicas, nodeResults)})
 
-	if numSuccessWrites < c.QuorumThreshold {
-		return fmt.Errorf("Writing to quorum not reached, try again later")
+	if len(acked) < threshold {
+		// Nodes that are behind also report conflicts, but only a newer version means
+		// the compare-and-swap lost
+		if conflict != nil && conflict.ObservedVersion > conflict.ExpectedVersion {
+			return acked, late, conflict
+		}
+		return acked, late, shared.QuorumFailed("Writing to quorum not reached, try again later")
 	}
 
 	log.Printf("Client %s reached quorum writing %s to address %s\n", c.ID, val, addr)
 
-	return nil
+	return acked, late, nil
 }
 
-func (c *Client) confirm(addr string) error {
-	log.Printf("Attempting to confirm address %s\n", addr)
-
-	confirmCh := make(chan error)
+// resolveLate confirms or aborts writeID on the nodes that accepted it after write returned
+func (c *Client) resolveLate(addr string, writeID string, late <-chan writeResult, resolve func(ctx context.Context, addr string, writeID string, node string) error) {
+	for res := range late {
+		if !res.ok() {
+			continue
+		}
 
-	// Write to the nodes in parallel
-	for _, port := range c.NodePorts {
-		port := port
-		go func(port string) {
-			err := c.confirmWithNode(addr, port)
-			confirmCh <- err
-		}(port)
+		if err := resolve(context.Background(), addr, writeID, res.Node); err != nil {
+			log.Printf("Error resolving write %s with node %s: %s", writeID, res.Node, err)
+		}
 	}
+}
+
+type confirmResult struct {
+	Node  string
+	Err   error
+	Start time.Time
+}
+
+// confirm confirms addr on the replicas with confirmWithNode, returning the nodes of the nodes that
+// confirmed it once it reaches quorum or can't. Confirms still in flight are left to finish in the background.
+func (c *Client) confirm(ctx context.Context, addr string, writeID string, confirmWithNode func(ctx context.Context, addr string, writeID string, node string) error, replicas []string, threshold int) ([]string, error) {
+	log.Printf("Attempting to confirm address %s for write %s\n", addr, writeID)
+
+	// Confirm with the replicas in parallel
+	results, _ := quorumCall(replicas, threshold, func(node string) confirmResult {
+		start := time.Now()
+		err := confirmWithNode(ctx, addr, writeID, node)
+		return confirmResult{Node: node, Err: err, Start: start}
+	}, func(res confirmResult) bool {
+		return res.Err == nil
+	})
 
 	// Collect the results
-	numSuccessConfirms := 0
-	for i := 0; i < len(c.NodePorts); i++ {
-		// TODO: don't wait for all confirms to complete
-		res := <-confirmCh
-		if res != nil {
-			log.Printf("Error writing to node: %s", res)
+	var confirmed []string
+	var nodeResults []NodeResult
+	for _, res := range results {
+		nodeResults = append(nodeResults, newNodeResult(res.Node, res.Start, 0, true, res.Err))
+		if res.Err != nil {
+			log.Printf("Error confirming with node %s: %s", res.Node, res.Err)
 		} else {
-			numSuccessConfirms++
+			confirmed = append(confirmed, res.Node)
 		}
 	}
+	recordPhase(ctx, Phase{Name: "confirm", Nodes: noResponse(replicas, nodeResults)})
 
-	if numSuccessConfirms < c.QuorumThreshold {
-		return fmt.Errorf("Confirming to quorum not reached, try again later")
+	if len(confirmed) < threshold {
+		return confirmed, shared.QuorumFailed("Confirming to quorum not reached, try again later")
 	}
 
 	log.Printf("Client %s reached quorum confirming to address %s\n", c.ID, addr)
 
-	return nil
+	return confirmed, nil
+}
+
+// abort clears the value writeID pre-committed at addr on the given nodes.
+// Failures are only logged, since the pending value will time out regardless.
+func (c *Client) abort(ctx context.Context, addr string, writeID string, nodes []string) {
+	if len(nodes) == 0 {
+		return
+	}
+
+	log.Printf("Attempting to abort write %s at address %s\n", writeID, addr)
+
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	phase := Phase{Name: "abort"}
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			start := time.Now()
+			err := c.abortWithNode(ctx, addr, writeID, node)
+			if err != nil {
+				log.Printf("Error aborting with node %s: %s", node, err)
+			}
+
+			mu.Lock()
+			phase.Nodes = append(phase.Nodes, newNodeResult(node, start, 0, true, err))
+			mu.Unlock()
+		}(node)
+	}
+
+	wg.Wait()
+	recordPhase(ctx, phase)
+}
+
+// do sends a request for path to node
+func (c *Client) do(ctx context.Context, method string, node string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, shared.CreateURL(node, path), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.clock.Send(req.Header)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.clock.Receive(resp.Header); err != nil {
+		log.Printf("Error reading clock from node %s: %s", node, err)
+	}
+
+	return resp, nil
+}
+
+// closeBody drains and closes resp's body, so its connection goes back to the pool
+func closeBody(resp *http.Response) {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
 }
 
-func (c *Client) readFromNode(addr string, port string) (shared.ValueVersion, bool, error) {
-	resp, err := c.httpClient.Get(shared.CreateURL(port, "/read?address="+addr))
+func (c *Client) readFromNode(ctx context.Context, addr string, node string) (shared.ValueVersion, bool, error) {
+	resp, err := c.do(ctx, http.MethodGet, node, "/read?address="+url.QueryEscape(addr), nil)
 	if err != nil {
 		return shared.ValueVersion{}, false, err
 	}
+	defer closeBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		return shared.ValueVersion{}, false, fmt.Errorf("Read failed: %d", resp.StatusCode)
+		return shared.ValueVersion{}, false, shared.ReadError(resp)
 	}
 
 	var res shared.NodeReadRes
@@ -231,18 +566,24 @@ func (c *Client) readFromNode(addr string, port string) (shared.ValueVersion, bo
 	return res.ValueVersion, res.ShouldInclude, nil
 }
 
-func (c *Client) writeToNode(addr string, val string, port string) (bool, error) {
+func (c *Client) writeToNode(ctx context.Context, addr string, val string, writeID string, expectedVersion *int, node string) (bool, error) {
 	body, _ := json.Marshal(shared.WriteReq{
-		Address: addr,
-		Value:   val,
+		Address:         addr,
+		Value:           val,
+		WriteID:         writeID,
+		ExpectedVersion: expectedVersion,
 	})
-	resp, err := c.httpClient.Post(shared.CreateURL(port, "/write"), "application/json", bytes.NewBuffer(body))
+	resp, err := c.do(ctx, http.MethodPost, node, "/write", bytes.NewBuffer(body))
 	if err != nil {
 		return false, err
 	}
+	defer closeBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("Write failed: %d", resp.StatusCode)
+		// A node that reports a conflict stores the address
+		err := shared.ReadError(resp)
+		var conflict *shared.ConflictError
+		return errors.As(err, &conflict), err
 	}
 
 	var res shared.NodeWriteRes
@@ -253,38 +594,62 @@ func (c *Client) writeToNode(addr string, val string, port string) (bool, error)
 	return res.ShouldInclude, nil
 }
 
-func (c *Client) confirmWithNode(addr string, port string) error {
+func (c *Client) confirmWithNode(ctx context.Context, addr string, writeID string, ts shared.Timestamp, node string) error {
 	body, _ := json.Marshal(shared.ConfirmReq{
-		Address: addr,
+		Address:   addr,
+		WriteID:   writeID,
+		Timestamp: ts,
 	})
-	req, _ := http.NewRequest(http.MethodPut, shared.CreateURL(port, "/confirm"), bytes.NewBuffer(body))
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, http.MethodPut, node, "/confirm", bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
+	defer closeBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Confirm failed: %d", resp.StatusCode)
+		return shared.ReadError(resp)
 	}
 
 	return nil
 }
 
-func (c *Client) updateNode(addr string, val string, version int, port string) error {
-	body, _ := json.Marshal(shared.UpdateReq{
+func (c *Client) abortWithNode(ctx context.Context, addr string, writeID string, node string) error {
+	body, _ := json.Marshal(shared.AbortReq{
 		Address: addr,
-		Value:   val,
-		Version: version,
+		WriteID: writeID,
 	})
-	req, _ := http.NewRequest(http.MethodPut, shared.CreateURL(port, "/update"), bytes.NewBuffer(body))
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, http.MethodPut, node, "/abort", bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
+	defer closeBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Update node failed: %d", resp.StatusCode)
+		return shared.ReadError(resp)
 	}
 
 	return nil
 }
+
+func (c *Client) updateNode(ctx context.Context, addr string, vv shared.ValueVersion, node string) (shared.NodeUpdateRes, error) {
+	body, _ := json.Marshal(shared.UpdateReq{
+		Address:      addr,
+		ValueVersion: vv,
+	})
+	resp, err := c.do(ctx, http.MethodPut, node, "/update", bytes.NewBuffer(body))
+	if err != nil {
+		return shared.NodeUpdateRes{}, err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return shared.NodeUpdateRes{}, shared.ReadError(resp)
+	}
+
+	var res shared.NodeUpdateRes
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return shared.NodeUpdateRes{}, err
+	}
+
+	return res, nil
+}
@@ -1,9 +1,12 @@
 package client
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/shekarramaswamy4/shared-register-abstraction/node"
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,28 +17,28 @@ func TestReplicasBasic(t *testing.T) {
 	n2 := node.New(1, 8081, 3, 2)
 	n3 := node.New(2, 8082, 3, 2)
 
-	c := New(8070, 3, 8080)
+	c := New(localNodes(3, 8080))
 
 	go n1.StartHTTP()
 	go n2.StartHTTP()
 	go n3.StartHTTP()
-	go c.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
 
-	err := c.Write("addr1", "val1")
+	err := c.Write(context.Background(), "addr1", "val1")
 	assert.Nil(t, err)
-	v, err := c.Read("addr1")
+	v, err := c.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, "val1", v.Value)
 	assert.Equal(t, 1, v.Version)
 
 	// Not stored on n1, so should return false
-	_, shouldInclude, err := n1.Read("addr1")
+	_, shouldInclude, err := n1.Read(context.Background(), "addr1")
 	assert.False(t, shouldInclude)
 
 	n1.Server.Close()
 	n2.Server.Close()
 	n3.Server.Close()
-	c.Server.Close()
+	c.Close()
 }
 
 // Tests that a write cannot go through if 1/2 replicas in a cluster of 3 is down.
@@ -48,20 +51,20 @@ func TestReplicasWithFault(t *testing.T) {
 
 	n2.Flags.RefuseWrite = true
 
-	c := New(8070, 3, 8080)
+	c := New(localNodes(3, 8080))
 
 	go n1.StartHTTP()
 	go n2.StartHTTP()
 	go n3.StartHTTP()
-	go c.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
 
-	err := c.Write("addr1", "val1")
+	err := c.Write(context.Background(), "addr1", "val1")
 	assert.NotNil(t, err)
 
 	n1.Server.Close()
 	n2.Server.Close()
 	n3.Server.Close()
-	c.Server.Close()
+	c.Close()
 }
 
 // Tests that if there's only one replica specified, then the write can't go through because
@@ -72,20 +75,20 @@ func TestInvalidReplicas(t *testing.T) {
 	n2 := node.New(1, 8081, 3, 1)
 	n3 := node.New(2, 8082, 3, 1)
 
-	c := New(8070, 3, 8080)
+	c := New(localNodes(3, 8080))
 
 	go n1.StartHTTP()
 	go n2.StartHTTP()
 	go n3.StartHTTP()
-	go c.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
 
-	err := c.Write("addr1", "val1")
+	err := c.Write(context.Background(), "addr1", "val1")
 	assert.NotNil(t, err)
 
 	n1.Server.Close()
 	n2.Server.Close()
 	n3.Server.Close()
-	c.Server.Close()
+	c.Close()
 }
 
 // Tests that in a cluster of 5 and 4 replicas, if one replica is down the write still goes through
@@ -100,26 +103,30 @@ func TestQuorumWithOneFaultyReplica(t *testing.T) {
 
 	n4.Flags.RefuseWrite = true
 
-	c := New(8070, 5, 8080)
+	c := New(localNodes(5, 8080))
 
 	go n1.StartHTTP()
 	go n2.StartHTTP()
 	go n3.StartHTTP()
 	go n4.StartHTTP()
 	go n5.StartHTTP()
-	go c.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082, 8083, 8084)
 
 	// Write should still go through
-	err := c.Write("addr1", "val1")
+	err := c.Write(context.Background(), "addr1", "val1")
 	assert.Nil(t, err)
-	v, err := c.Read("addr1")
+	v, err := c.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, "val1", v.Value)
 	assert.Equal(t, 1, v.Version)
 
 	// n3 should be updated
-	vv, shouldInclude, err := n4.Read("addr1")
-	assert.Nil(t, err)
+	var vv shared.ValueVersion
+	var shouldInclude bool
+	assert.Eventually(t, func() bool {
+		vv, shouldInclude, err = n4.Read(context.Background(), "addr1")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
 	assert.True(t, shouldInclude)
 	assert.Equal(t, "val1", vv.Value)
 
@@ -128,5 +135,56 @@ func TestQuorumWithOneFaultyReplica(t *testing.T) {
 	n3.Server.Close()
 	n4.Server.Close()
 	n5.Server.Close()
-	c.Server.Close()
+	c.Close()
+}
+
+// Tests that a replica-aware client counts quorum against the replica set, so a cluster of 5
+// with 3 replicas tolerates a replica being down
+func TestReplicaAwareQuorum(t *testing.T) {
+	// hash(addr1) = 1443559033, 1443559033 % 5 = 3
+	// This means that addr1 is stored on nodes 3, 4 and 0
+	n1 := node.New(0, 8080, 5, 3)
+	n2 := node.New(1, 8081, 5, 3)
+	n3 := node.New(2, 8082, 5, 3)
+	n4 := node.New(3, 8083, 5, 3)
+	n5 := node.New(4, 8084, 5, 3)
+
+	n4.Flags.RefuseWrite = true
+
+	c := New(localNodes(5, 8080))
+	replicaAware := New(localNodes(5, 8080), WithNumReplicas(3))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	go n4.StartHTTP()
+	go n5.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082, 8083, 8084)
+
+	assert.Equal(t, []string{"localhost:8080", "localhost:8083", "localhost:8084"}, replicaAware.replicaNodes("addr1"))
+
+	// 2 of 5 nodes isn't a majority of the cluster
+	err := c.Write(context.Background(), "addr1", "val1")
+	assert.NotNil(t, err)
+	waitForNoPending(t, "addr1", n1, n5)
+
+	// but 2 of 3 is a majority of the replicas
+	err = replicaAware.Write(context.Background(), "addr1", "val1")
+	assert.Nil(t, err)
+	v, err := replicaAware.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", v.Value)
+	assert.Equal(t, 1, v.Version)
+
+	// Nodes outside the replica set are never contacted, not even to repair them
+	_, ok := n2.Storage.Get("addr1")
+	assert.False(t, ok)
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	n4.Server.Close()
+	n5.Server.Close()
+	c.Close()
+	replicaAware.Close()
 }
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/node"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests that a write confirmed on some node, but whose client died before reaching quorum,
+// is rolled forward to every replica
+func TestRecoverRollForward(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	// The write is only confirmed on n1, and the client never aborts it on n2 and n3
+	n2.Flags.RefuseConfirm = true
+	n3.Flags.RefuseConfirm = true
+	n2.Flags.RefuseAbort = true
+	n3.Flags.RefuseAbort = true
+
+	c := New(localNodes(3, 8080))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	err := c.Write(context.Background(), "addr1", "val1")
+	assert.NotNil(t, err)
+
+	n2.Flags = node.TestingFlags{}
+	n3.Flags = node.TestingFlags{}
+
+	// Nothing has timed out yet, so there's nothing to recover
+	err = c.RecoverPending(context.Background())
+	assert.Nil(t, err)
+	_, _, err = n2.Read(context.Background(), "addr1")
+	assert.NotNil(t, err)
+
+	forwardTime := time.Now().UTC().Add(time.Second * 3)
+	n1.Flags.Time = &forwardTime
+	n2.Flags.Time = &forwardTime
+	n3.Flags.Time = &forwardTime
+
+	err = c.RecoverPending(context.Background())
+	assert.Nil(t, err)
+
+	for _, n := range []*node.Node{n1, n2, n3} {
+		v, _, err := n.Read(context.Background(), "addr1")
+		assert.Nil(t, err)
+		assert.Equal(t, "val1", v.Value)
+		assert.Equal(t, 1, v.Version)
+		assert.Empty(t, n.StalePending())
+	}
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
+}
+
+// Tests that a write no node confirmed is discarded, so it stops blocking other writers
+func TestRecoverDiscard(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	for _, n := range []*node.Node{n1, n2, n3} {
+		n.Flags.RefuseConfirm = true
+		n.Flags.RefuseAbort = true
+	}
+
+	c := New(localNodes(3, 8080))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	err := c.Write(context.Background(), "addr1", "val1")
+	assert.NotNil(t, err)
+
+	forwardTime := time.Now().UTC().Add(time.Second * 3)
+	for _, n := range []*node.Node{n1, n2, n3} {
+		n.Flags = node.TestingFlags{Time: &forwardTime}
+	}
+
+	err = c.RecoverPending(context.Background())
+	assert.Nil(t, err)
+
+	for _, n := range []*node.Node{n1, n2, n3} {
+		_, _, err := n.Read(context.Background(), "addr1")
+		assert.NotNil(t, err)
+		assert.Empty(t, n.StalePending())
+	}
+
+	// Back to the present, the next write doesn't have to wait out the pending timeout
+	for _, n := range []*node.Node{n1, n2, n3} {
+		n.Flags = node.TestingFlags{}
+	}
+	err = c.Write(context.Background(), "addr1", "val2")
+	assert.Nil(t, err)
+	v, err := c.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", v.Value)
+	assert.Equal(t, 1, v.Version)
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
+}
@@ -1,29 +1,35 @@
 package client
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/shekarramaswamy4/shared-register-abstraction/node"
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestInitialization(t *testing.T) {
 	n1 := node.New(0, 8080, 1, 1)
-	c := New(8070, 1, 8080)
+	c := New(localNodes(1, 8080))
 
 	go n1.StartHTTP()
-	go c.StartHTTP()
+	waitForServers(t, 8080)
 
-	err := c.Write("addr1", "val1")
+	err := c.Write(context.Background(), "addr1", "val1")
 	assert.Nil(t, err)
-	v, err := c.Read("addr1")
+	v, err := c.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, "val1", v.Value)
 	assert.Equal(t, 1, v.Version)
 
 	n1.Server.Close()
-	c.Server.Close()
+	c.Close()
 }
 
 func Test3Nodes(t *testing.T) {
@@ -31,16 +37,19 @@ func Test3Nodes(t *testing.T) {
 	n2 := node.New(1, 8081, 3, 3)
 	n3 := node.New(2, 8082, 3, 3)
 
-	c := New(8070, 3, 8080)
+	c := New(localNodes(3, 8080))
 
 	go n1.StartHTTP()
 	go n2.StartHTTP()
 	go n3.StartHTTP()
-	go c.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
 
-	err := c.Write("addr1", "val1")
+	_, err := c.Read(context.Background(), "addr1")
+	assert.ErrorIs(t, err, shared.ErrNotFound)
+
+	err = c.Write(context.Background(), "addr1", "val1")
 	assert.Nil(t, err)
-	v, err := c.Read("addr1")
+	v, err := c.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, "val1", v.Value)
 	assert.Equal(t, 1, v.Version)
@@ -48,7 +57,39 @@ func Test3Nodes(t *testing.T) {
 	n1.Server.Close()
 	n2.Server.Close()
 	n3.Server.Close()
-	c.Server.Close()
+	c.Close()
+}
+
+// Test addresses that have to be escaped in query strings
+func TestAddressEscaping(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	c := New(localNodes(3, 8080))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	for _, addr := range []string{"a&address=b", "a b/c?d", "100%"} {
+		err := c.Write(context.Background(), addr, "val-"+addr)
+		assert.Nil(t, err)
+		v, err := c.Read(context.Background(), addr)
+		assert.Nil(t, err)
+		assert.Equal(t, "val-"+addr, v.Value)
+
+		states := c.AddressStates(context.Background(), addr)
+		for _, st := range states {
+			assert.Nil(t, st.Err)
+		}
+	}
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
 }
 
 // TestOneDownNodeAndForceUpdate tests the case where one node out of three is down.
@@ -60,44 +101,46 @@ func TestOneDownNodeAndForceUpdate(t *testing.T) {
 
 	n1.Flags.RefuseWrite = true
 
-	c := New(8070, 3, 8080)
+	c := New(localNodes(3, 8080))
 
 	go n1.StartHTTP()
 	go n2.StartHTTP()
 	go n3.StartHTTP()
-	go c.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
 
-	err := c.Write("addr1", "val1")
+	err := c.Write(context.Background(), "addr1", "val1")
 	assert.Nil(t, err)
 
-	v, _, err := n1.Read("addr1")
+	v, _, err := n1.Read(context.Background(), "addr1")
 	// n1 doesn't have anything written to it yet
 	assert.NotNil(t, err)
-	v, _, err = n2.Read("addr1")
+	v, _, err = n2.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, "val1", v.Value)
 	assert.Equal(t, 1, v.Version)
-	v, _, err = n3.Read("addr1")
+	v, _, err = n3.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, "val1", v.Value)
 	assert.Equal(t, 1, v.Version)
 
-	v, err = c.Read("addr1")
+	v, err = c.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, "val1", v.Value)
 	assert.Equal(t, 1, v.Version)
 
 	// After reading, the client should update other members to get up to speed
-	// Therefore, n1 should be updated
-	v, _, err = n1.Read("addr1")
-	assert.Nil(t, err)
+	// Therefore, n1 should be updated, possibly after the read returned
+	assert.Eventually(t, func() bool {
+		v, _, err = n1.Read(context.Background(), "addr1")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
 	assert.Equal(t, "val1", v.Value)
 	assert.Equal(t, 1, v.Version)
 
 	n1.Server.Close()
 	n2.Server.Close()
 	n3.Server.Close()
-	c.Server.Close()
+	c.Close()
 }
 
 func TestNoQuorumWrites(t *testing.T) {
@@ -108,20 +151,20 @@ func TestNoQuorumWrites(t *testing.T) {
 	n1.Flags.RefuseWrite = true
 	n2.Flags.RefuseWrite = true
 
-	c := New(8070, 3, 8080)
+	c := New(localNodes(3, 8080))
 
 	go n1.StartHTTP()
 	go n2.StartHTTP()
 	go n3.StartHTTP()
-	go c.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
 
-	err := c.Write("addr1", "val1")
-	assert.NotNil(t, err)
+	err := c.Write(context.Background(), "addr1", "val1")
+	assert.ErrorIs(t, err, shared.ErrQuorumFailed)
 
 	n1.Server.Close()
 	n2.Server.Close()
 	n3.Server.Close()
-	c.Server.Close()
+	c.Close()
 }
 
 // Test that values aren't written if there's no confirmation.
@@ -133,27 +176,30 @@ func TestNoQuorumConfirms(t *testing.T) {
 
 	n1.Flags.RefuseConfirm = true
 	n2.Flags.RefuseConfirm = true
+	// Keep the failed write from clearing its pending values, as if the client crashed
+	n1.Flags.RefuseAbort = true
+	n2.Flags.RefuseAbort = true
 
-	c := New(8070, 3, 8080)
+	c := New(localNodes(3, 8080))
 
 	go n1.StartHTTP()
 	go n2.StartHTTP()
 	go n3.StartHTTP()
-	go c.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
 
 	// Should fail b/c of no confirmations
-	err := c.Write("addr1", "val1")
+	err := c.Write(context.Background(), "addr1", "val1")
 	assert.NotNil(t, err)
 
 	n1.Flags.RefuseConfirm = false
 	n2.Flags.RefuseConfirm = false
 	// Should fail b/c of the pending confirmations
-	err = c.Write("addr1", "val2")
+	err = c.Write(context.Background(), "addr1", "val2")
 	assert.NotNil(t, err)
 	// Should succeed b/c different keys
-	err = c.Write("addr2", "val3")
+	err = c.Write(context.Background(), "addr2", "val3")
 	assert.Nil(t, err)
-	v, err := c.Read("addr2")
+	v, err := c.Read(context.Background(), "addr2")
 	assert.Nil(t, err)
 	assert.Equal(t, "val3", v.Value)
 	assert.Equal(t, 1, v.Version)
@@ -162,13 +208,81 @@ func TestNoQuorumConfirms(t *testing.T) {
 	n1.Flags.Time = &forwardTime
 	n2.Flags.Time = &forwardTime
 	// Should succeed since the pending confirmations have expired
-	err = c.Write("addr1", "val2")
+	err = c.Write(context.Background(), "addr1", "val2")
+	assert.Nil(t, err)
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
+}
+
+// Test that a write that doesn't reach quorum clears the pre-commits that went through,
+// so the next write doesn't have to wait for them to time out
+func TestAbortOnNoQuorumWrites(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	n1.Flags.RefuseWrite = true
+	n2.Flags.RefuseWrite = true
+
+	c := New(localNodes(3, 8080))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	err := c.Write(context.Background(), "addr1", "val1")
+	assert.NotNil(t, err)
+
+	n1.Flags.RefuseWrite = false
+	n2.Flags.RefuseWrite = false
+	err = c.Write(context.Background(), "addr1", "val2")
+	assert.Nil(t, err)
+	v, err := c.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
+	assert.Equal(t, "val2", v.Value)
 
 	n1.Server.Close()
 	n2.Server.Close()
 	n3.Server.Close()
-	c.Server.Close()
+	c.Close()
+}
+
+// Test that a write that doesn't reach a quorum of confirms clears its pending values
+func TestAbortOnNoQuorumConfirms(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	n1.Flags.RefuseConfirm = true
+	n2.Flags.RefuseConfirm = true
+
+	c := New(localNodes(3, 8080))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	err := c.Write(context.Background(), "addr1", "val1")
+	assert.NotNil(t, err)
+
+	n1.Flags.RefuseConfirm = false
+	n2.Flags.RefuseConfirm = false
+	// Succeeds right away, without waiting for the pending values to time out
+	err = c.Write(context.Background(), "addr1", "val2")
+	assert.Nil(t, err)
+	v, err := c.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", v.Value)
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
 }
 
 // Test one client can read another's writes
@@ -178,25 +292,24 @@ func TestMultiClientBasic(t *testing.T) {
 	n2 := node.New(1, 8081, 3, 3)
 	n3 := node.New(2, 8082, 3, 3)
 
-	c1 := New(8070, 3, 8080)
-	c2 := New(8070, 3, 8080)
+	c1 := New(localNodes(3, 8080))
+	c2 := New(localNodes(3, 8080))
 
 	go n1.StartHTTP()
 	go n2.StartHTTP()
 	go n3.StartHTTP()
-	go c1.StartHTTP()
-	go c2.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
 
-	err := c1.Write("addr1", "val1")
+	err := c1.Write(context.Background(), "addr1", "val1")
 	assert.Nil(t, err)
-	v, err := c2.Read("addr1")
+	v, err := c2.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, "val1", v.Value)
 	assert.Equal(t, 1, v.Version)
 
-	err = c2.Write("addr1", "val3")
+	err = c2.Write(context.Background(), "addr1", "val3")
 	assert.Nil(t, err)
-	v, err = c1.Read("addr1")
+	v, err = c1.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, "val3", v.Value)
 	assert.Equal(t, 2, v.Version)
@@ -204,6 +317,571 @@ func TestMultiClientBasic(t *testing.T) {
 	n1.Server.Close()
 	n2.Server.Close()
 	n3.Server.Close()
-	c1.Server.Close()
-	c2.Server.Close()
+	c1.Close()
+	c2.Close()
+}
+
+// Test that a compare-and-swap only goes through at the expected version,
+// and that losing one reports the version that was observed
+func TestCompareAndSwap(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	c1 := New(localNodes(3, 8080))
+	c2 := New(localNodes(3, 8080))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	err := c1.CompareAndSwap(context.Background(), "addr1", 0, "val1")
+	assert.Nil(t, err)
+
+	// Both clients read version 1 and race to swap it
+	err = c1.CompareAndSwap(context.Background(), "addr1", 1, "val2")
+	assert.Nil(t, err)
+	err = c2.CompareAndSwap(context.Background(), "addr1", 1, "val3")
+	var conflict *shared.ConflictError
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, 1, conflict.ExpectedVersion)
+	assert.Equal(t, 2, conflict.ObservedVersion)
+
+	v, err := c2.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", v.Value)
+	assert.Equal(t, 2, v.Version)
+
+	err = c2.CompareAndSwap(context.Background(), "addr1", conflict.ObservedVersion, "val3")
+	assert.Nil(t, err)
+	v, err = c1.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val3", v.Value)
+	assert.Equal(t, 3, v.Version)
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c1.Close()
+	c2.Close()
+}
+
+// Test that every replica stores the writer's commit timestamp, and that a write that saw
+// another comes after it
+func TestCommitTimestamps(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	c1 := New(localNodes(3, 8080))
+	c2 := New(localNodes(3, 8080))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	before := time.Now()
+	err := c1.Write(context.Background(), "addr1", "val1")
+	assert.Nil(t, err)
+	v1, err := c2.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.WithinRange(t, v1.Timestamp.Time(), before, time.Now())
+
+	err = c2.CompareAndSwap(context.Background(), "addr1", v1.Version, "val2")
+	assert.Nil(t, err)
+	// Reading from every replica repairs the ones still behind before it returns
+	v2, err := c1.ReadWithOptions(context.Background(), "addr1", ReadOptions{Quorum: QuorumAll})
+	assert.Nil(t, err)
+	assert.True(t, v1.Timestamp.Before(v2.Timestamp))
+
+	for _, n := range []*node.Node{n1, n2, n3} {
+		vv, _, err := n.Read(context.Background(), "addr1")
+		assert.Nil(t, err)
+		assert.Equal(t, v2, vv)
+	}
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c1.Close()
+	c2.Close()
+}
+
+// Test that replicas holding the same version from different writes agree on one of them
+func TestConcurrentVersionTiebreak(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	// Two writes confirmed version 1 on different majorities after a pending timeout
+	a := shared.ValueVersion{Value: "valA", Version: 1, WriteID: "clientA-1"}
+	b := shared.ValueVersion{Value: "valB", Version: 1, WriteID: "clientB-1"}
+	for n, vv := range map[*node.Node]shared.ValueVersion{n1: a, n2: b, n3: a} {
+		_, err := n.Update(context.Background(), "addr1", vv)
+		assert.Nil(t, err)
+	}
+
+	c := New(localNodes(3, 8080))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	// The write ID breaks the tie, no matter which replicas respond first
+	v, err := c.ReadWithOptions(context.Background(), "addr1", ReadOptions{Quorum: QuorumAll})
+	assert.Nil(t, err)
+	assert.Equal(t, b, v)
+
+	// The replicas holding the other write are repaired
+	for _, n := range []*node.Node{n1, n2, n3} {
+		vv, _, err := n.Read(context.Background(), "addr1")
+		assert.Nil(t, err)
+		assert.Equal(t, b, vv)
+	}
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
+}
+
+// Test that a linearizable read only returns once the value it read is on a quorum
+func TestLinearizableRead(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	// Reads hear from every node, so they always see n3
+	c := New(localNodes(3, 8080), WithReadQuorum(QuorumAll))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	err := c.Write(context.Background(), "addr1", "val1")
+	assert.Nil(t, err)
+
+	// val2 is only confirmed on n3
+	n1.Flags.RefuseConfirm = true
+	n2.Flags.RefuseConfirm = true
+	err = c.Write(context.Background(), "addr1", "val2")
+	assert.NotNil(t, err)
+
+	// n3 is the only node with version 2, and it can't be written back
+	n1.Flags.RefuseUpdate = true
+	n2.Flags.RefuseUpdate = true
+	_, err = c.ReadWithOptions(context.Background(), "addr1", ReadOptions{Consistency: ConsistencyLinearizable})
+	assert.NotNil(t, err)
+
+	// A regular read returns it anyway
+	v, err := c.ReadWithOptions(context.Background(), "addr1", ReadOptions{Consistency: ConsistencyRegular})
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", v.Value)
+	assert.Equal(t, 2, v.Version)
+
+	// Once n1 accepts the write back, version 2 is on a quorum
+	n1.Flags.RefuseUpdate = false
+	v, err = c.ReadWithOptions(context.Background(), "addr1", ReadOptions{Consistency: ConsistencyLinearizable})
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", v.Value)
+	assert.Equal(t, 2, v.Version)
+
+	v, _, err = n1.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", v.Value)
+	assert.Equal(t, 2, v.Version)
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
+}
+
+// Test that a linearizable read from ONE still writes back to a write quorum, and doesn't fail
+// because it only heard from one replica
+func TestLinearizableReadOne(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	c := New(localNodes(3, 8080), WithReadQuorum(QuorumOne))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	err := c.Write(context.Background(), "addr1", "val1")
+	assert.Nil(t, err)
+	waitForNoPending(t, "addr1", n1, n2, n3)
+
+	// Every replica is up to date
+	for i := 0; i < 10; i++ {
+		v, err := c.ReadWithOptions(context.Background(), "addr1", ReadOptions{Consistency: ConsistencyLinearizable})
+		assert.Nil(t, err)
+		assert.Equal(t, "val1", v.Value)
+		assert.Equal(t, 1, v.Version)
+	}
+
+	// A read from ONE that can only reach one replica is fine, unless it's linearizable
+	n2.Flags.RefuseRead = true
+	n3.Flags.RefuseRead = true
+	n2.Flags.RefuseUpdate = true
+	n3.Flags.RefuseUpdate = true
+	v, err := c.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", v.Value)
+	_, err = c.ReadWithOptions(context.Background(), "addr1", ReadOptions{Consistency: ConsistencyLinearizable})
+	assert.ErrorIs(t, err, shared.ErrQuorumFailed)
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
+}
+
+// Test that reads and writes can ask for fewer or more acks than a majority
+func TestTunableQuorums(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	n2.Flags.RefuseWrite = true
+	n3.Flags.RefuseWrite = true
+
+	c := New(localNodes(3, 8080), WithReadQuorum(QuorumAll))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	// Only n1 accepts writes
+	err := c.Write(context.Background(), "addr1", "val1")
+	assert.NotNil(t, err)
+	err = c.WriteWithOptions(context.Background(), "addr1", "val1", WriteOptions{Quorum: QuorumOne})
+	assert.Nil(t, err)
+
+	// n2 and n3 don't have the address, so only a read from ONE succeeds
+	_, err = c.Read(context.Background(), "addr1")
+	assert.NotNil(t, err)
+	v, err := c.ReadWithOptions(context.Background(), "addr1", ReadOptions{Quorum: QuorumOne})
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", v.Value)
+	assert.Equal(t, 1, v.Version)
+
+	// Overrides that can't be reached are rejected before anything is sent
+	_, err = c.ReadWithOptions(context.Background(), "addr1", ReadOptions{Quorum: "4"})
+	assert.ErrorIs(t, err, shared.ErrBadRequest)
+	err = c.WriteWithOptions(context.Background(), "addr1", "val2", WriteOptions{Quorum: "4"})
+	assert.ErrorIs(t, err, shared.ErrBadRequest)
+
+	// Once every node has been repaired in the background, the default read from ALL works
+	assert.Eventually(t, func() bool {
+		v, err = c.Read(context.Background(), "addr1")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "val1", v.Value)
+	assert.Equal(t, 1, v.Version)
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
+}
+
+// Test that reads and writes return once a quorum responds, without waiting for a hung node
+func TestEarlyQuorumReturn(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+
+	// The third node accepts connections but never responds until the test is done
+	release := make(chan struct{})
+	hung := &http.Server{
+		Addr: ":8082",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusInternalServerError)
+		}),
+	}
+
+	c := New(localNodes(3, 8080))
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go hung.ListenAndServe()
+	waitForServers(t, 8080, 8081, 8082)
+
+	start := time.Now()
+	err := c.Write(context.Background(), "addr1", "val1")
+	assert.Nil(t, err)
+	v, err := c.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", v.Value)
+	assert.Equal(t, 1, v.Version)
+	assert.Less(t, time.Since(start), time.Second)
+
+	close(release)
+	n1.Server.Close()
+	n2.Server.Close()
+	hung.Close()
+	c.Close()
+}
+
+// Test that a read waiting on a hung node gives up at the caller's deadline
+func TestReadDeadline(t *testing.T) {
+	n1 := node.New(0, 8080, 2, 2)
+
+	release := make(chan struct{})
+	hung := &http.Server{
+		Addr: ":8081",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusInternalServerError)
+		}),
+	}
+
+	c := New(localNodes(2, 8080), WithWriteQuorum(QuorumOne), WithReadQuorum(QuorumAll))
+
+	go n1.StartHTTP()
+	go hung.ListenAndServe()
+	waitForServers(t, 8080, 8081)
+
+	_, err := n1.Write(context.Background(), "addr1", "val1", "w1")
+	assert.Nil(t, err)
+	err = n1.Confirm(context.Background(), "addr1", "w1")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = c.Read(ctx, "addr1")
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+
+	close(release)
+	n1.Server.Close()
+	hung.Close()
+	c.Close()
+}
+
+func TestDial(t *testing.T) {
+	_, err := Dial(Config{})
+	assert.NotNil(t, err)
+	_, err = Dial(Config{Nodes: []string{"localhost:8080", "8081", "localhost:8082"}})
+	assert.NotNil(t, err)
+	_, err = Dial(Config{Nodes: []string{"localhost:8080", "ftp://localhost:8081", "localhost:8082"}})
+	assert.NotNil(t, err)
+	_, err = Dial(Config{Nodes: localNodes(3, 8080), NumReplicas: 4})
+	assert.NotNil(t, err)
+	_, err = Dial(Config{Nodes: localNodes(3, 8080), ReadQuorum: "SOME"})
+	assert.NotNil(t, err)
+	_, err = Dial(Config{Nodes: localNodes(3, 8080), NumReplicas: 2, WriteQuorum: "3"})
+	assert.NotNil(t, err)
+
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	c, err := Dial(Config{Nodes: localNodes(3, 8080), ReadQuorum: "all"})
+	assert.Nil(t, err)
+	assert.Equal(t, QuorumAll, c.ReadQuorum)
+	assert.Equal(t, QuorumMajority, c.WriteQuorum)
+
+	err = c.Write(context.Background(), "addr1", "val1")
+	assert.Nil(t, err)
+	err = c.CompareAndSwap(context.Background(), "addr1", 1, "val2")
+	assert.Nil(t, err)
+	v, err := c.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", v.Value)
+	assert.Equal(t, 2, v.Version)
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
+}
+
+func TestDumpAndNodeStatuses(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	c := New(localNodes(3, 8080), WithWriteQuorum(QuorumAll))
+
+	err := c.Write(context.Background(), "addr2", "val2")
+	assert.Nil(t, err)
+	err = c.Write(context.Background(), "addr1", "val1")
+	assert.Nil(t, err)
+	err = c.Write(context.Background(), "addr1", "val3")
+	assert.Nil(t, err)
+
+	dumps, err := c.Dump(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, dumps, 2)
+	assert.Equal(t, "addr1", dumps[0].Address)
+	assert.Equal(t, "val3", dumps[0].Latest.Value)
+	assert.Equal(t, 2, dumps[0].Latest.Version)
+	assert.Len(t, dumps[0].States, 3)
+	assert.Equal(t, "addr2", dumps[1].Address)
+
+	statuses := c.NodeStatuses(context.Background())
+	assert.Len(t, statuses, 3)
+	for i, s := range statuses {
+		assert.Nil(t, s.Err)
+		assert.Equal(t, i, s.Status.ID)
+		assert.Equal(t, 2, s.Status.Addresses)
+	}
+
+	// A down node is reported, and the rest of the dump is still returned
+	n3.Server.Close()
+	dumps, err = c.Dump(context.Background())
+	assert.NotNil(t, err)
+	assert.Len(t, dumps, 2)
+	assert.Len(t, dumps[0].States, 2)
+
+	statuses = c.NodeStatuses(context.Background())
+	assert.Nil(t, statuses[0].Err)
+	assert.NotNil(t, statuses[2].Err)
+
+	n1.Server.Close()
+	n2.Server.Close()
+	c.Close()
+}
+
+func TestTraceAndNodeFlags(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082)
+
+	c := New(localNodes(3, 8080))
+	nodes := c.Nodes
+
+	flags, err := c.SetNodeFlags(context.Background(), nodes[2], shared.NodeFlags{RefuseConfirm: true})
+	assert.Nil(t, err)
+	assert.True(t, flags.RefuseConfirm)
+	assert.True(t, n3.RefuseFlags().RefuseConfirm)
+	flags, err = c.NodeFlags(context.Background(), nodes[2])
+	assert.Nil(t, err)
+	assert.Equal(t, shared.NodeFlags{RefuseConfirm: true}, flags)
+
+	// With an ALL quorum, the confirm phase stops at the first node that refuses
+	c.WriteQuorum = QuorumAll
+	trace := &Trace{}
+	err = c.Write(WithTrace(context.Background(), trace), "addr1", "val1")
+	assert.NotNil(t, err)
+
+	phases := trace.Phases()
+	assert.Len(t, phases, 3)
+	assert.Equal(t, "write", phases[0].Name)
+	assert.ElementsMatch(t, nodes, phases[0].Acked())
+	assert.Equal(t, "confirm", phases[1].Name)
+	assert.Subset(t, nodes[:2], phases[1].Acked())
+	assert.Len(t, phases[1].Nodes, 3)
+	for _, res := range phases[1].Nodes {
+		if res.Node == nodes[2] {
+			assert.Equal(t, OutcomeRefused, res.Outcome)
+			assert.ErrorContains(t, res.Err, "Refusing to confirm")
+		}
+	}
+	assert.Equal(t, "abort", phases[2].Name)
+	assert.Contains(t, phases[2].Acked(), nodes[2])
+
+	// The third node misses the second write to addr2, and is repaired by the next read
+	_, err = c.SetNodeFlags(context.Background(), nodes[2], shared.NodeFlags{})
+	assert.Nil(t, err)
+	assert.False(t, n3.RefuseFlags().RefuseConfirm)
+	err = c.Write(context.Background(), "addr2", "val1")
+	assert.Nil(t, err)
+
+	_, err = c.SetNodeFlags(context.Background(), nodes[2], shared.NodeFlags{RefuseWrite: true})
+	assert.Nil(t, err)
+	c.WriteQuorum = QuorumMajority
+	err = c.Write(context.Background(), "addr2", "val2")
+	assert.Nil(t, err)
+	_, err = c.SetNodeFlags(context.Background(), nodes[2], shared.NodeFlags{})
+	assert.Nil(t, err)
+
+	trace.Reset()
+	c.ReadQuorum = QuorumAll
+	v, err := c.Read(WithTrace(context.Background(), trace), "addr2")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, v.Version)
+
+	phases = trace.Phases()
+	assert.Len(t, phases, 2)
+	assert.Equal(t, "read", phases[0].Name)
+	assert.ElementsMatch(t, nodes, phases[0].Acked())
+	for _, res := range phases[0].Nodes {
+		if res.Node == nodes[2] {
+			assert.Equal(t, 1, res.Version)
+		} else {
+			assert.Equal(t, 2, res.Version)
+		}
+		assert.Greater(t, res.Latency, time.Duration(0))
+	}
+	assert.Equal(t, "repair", phases[1].Name)
+	assert.Equal(t, []string{nodes[2]}, phases[1].Acked())
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	c.Close()
+}
+
+// waitForServers blocks until every port accepts connections.
+// Servers are started in their own goroutines, so requests sent right away can beat the listener.
+func waitForServers(t *testing.T, ports ...int) {
+	for _, port := range ports {
+		addr := net.JoinHostPort("localhost", strconv.Itoa(port))
+		assert.Eventually(t, func() bool {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				return false
+			}
+			conn.Close()
+			return true
+		}, time.Second, 5*time.Millisecond)
+	}
+}
+
+// localNodes returns the addresses of numNodes nodes running locally on consecutive ports
+func localNodes(numNodes int, firstPort int) []string {
+	nodes := make([]string, numNodes)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("localhost:%d", firstPort+i)
+	}
+	return nodes
+}
+
+// waitForNoPending blocks until addr has no pending value on any of the nodes.
+// A write that fails early aborts the pre-commits that come in after it returned in the background.
+func waitForNoPending(t *testing.T, addr string, nodes ...*node.Node) {
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool {
+			ad, _ := n.Storage.Get(addr)
+			return ad.PendingValue == nil
+		}, time.Second, 5*time.Millisecond)
+	}
 }
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+)
+
+// Config describes the cluster a client connects to, and the client's defaults
+type Config struct {
+	// Nodes are the addresses of every node, in order of node ID.
+	// Addresses are host:port, or a URL such as https://host:port.
+	Nodes []string
+	// NumReplicas is how many nodes each address is replicated to, which has to match the nodes'.
+	// Defaults to every node.
+	NumReplicas int
+	// ReadQuorum and WriteQuorum default to QUORUM
+	ReadQuorum  Quorum
+	WriteQuorum Quorum
+	// Timeout bounds each request to a node. Defaults to 3 seconds.
+	Timeout time.Duration
+	// RecoveryInterval is how often to recover pending writes left behind by crashed clients.
+	// 0 disables recovery.
+	RecoveryInterval time.Duration
+}
+
+// Validate checks that cfg describes a cluster a client can be created for
+func (cfg Config) Validate() error {
+	_, err := cfg.options()
+	return err
+}
+
+// Dial validates cfg and returns a client for the cluster it describes.
+// Nodes aren't contacted until the first request. Call Close once done with the client.
+func Dial(cfg Config) (*Client, error) {
+	opts, err := cfg.options()
+	if err != nil {
+		return nil, err
+	}
+
+	c := New(cfg.Nodes, opts...)
+	if cfg.RecoveryInterval > 0 {
+		c.StartRecovery(cfg.RecoveryInterval)
+	}
+
+	return c, nil
+}
+
+// options validates cfg and returns the options that configure a client for it
+func (cfg Config) options() ([]Option, error) {
+	if len(cfg.Nodes) == 0 {
+		return nil, errors.New("At least one node is required")
+	}
+	for _, node := range cfg.Nodes {
+		if err := shared.ValidateNodeAddr(node); err != nil {
+			return nil, err
+		}
+	}
+
+	numReplicas := cfg.NumReplicas
+	if numReplicas == 0 {
+		numReplicas = len(cfg.Nodes)
+	}
+	if numReplicas < 1 || numReplicas > len(cfg.Nodes) {
+		return nil, fmt.Errorf("Number of replicas must be between 1 and %d, got %d", len(cfg.Nodes), numReplicas)
+	}
+
+	readQuorum, err := validQuorum("read", cfg.ReadQuorum, numReplicas)
+	if err != nil {
+		return nil, err
+	}
+	writeQuorum, err := validQuorum("write", cfg.WriteQuorum, numReplicas)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []Option{WithNumReplicas(numReplicas), WithReadQuorum(readQuorum), WithWriteQuorum(writeQuorum)}
+	if cfg.Timeout < 0 {
+		return nil, fmt.Errorf("Timeout must not be negative, got %v", cfg.Timeout)
+	} else if cfg.Timeout > 0 {
+		opts = append(opts, WithTimeout(cfg.Timeout))
+	}
+	if cfg.RecoveryInterval < 0 {
+		return nil, fmt.Errorf("Recovery interval must not be negative, got %v", cfg.RecoveryInterval)
+	}
+
+	return opts, nil
+}
+
+// WithTimeout sets how long each request to a node can take. Defaults to 3 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
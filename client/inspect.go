@@ -0,0 +1,202 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+)
+
+// NodeStatus is what a node reports about itself, or the error reaching it
+type NodeStatus struct {
+	Node   string
+	Status shared.NodeStatusRes
+	Err    error
+}
+
+// NodeStatuses asks every node for its status, in order of node ID
+func (c *Client) NodeStatuses(ctx context.Context) []NodeStatus {
+	statuses := make([]NodeStatus, len(c.Nodes))
+
+	wg := sync.WaitGroup{}
+	for i, node := range c.Nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			status, err := c.statusFromNode(ctx, node)
+			statuses[i] = NodeStatus{Node: node, Status: status, Err: err}
+		}(i, node)
+	}
+
+	wg.Wait()
+
+	return statuses
+}
+
+// AddressDump is an address's state on each node that stores it
+type AddressDump struct {
+	Address string
+	// Latest is the newest version confirmed on any node
+	Latest shared.ValueVersion
+	// States maps the address of each node storing the address to its state there
+	States map[string]shared.NodeStateRes
+}
+
+type dumpResult struct {
+	States map[string]shared.NodeStateRes
+	Node   string
+	Err    error
+}
+
+// Dump collects every address stored on any node, sorted by address.
+// If some nodes can't be reached, the addresses on the others are returned along with an error.
+func (c *Client) Dump(ctx context.Context) ([]AddressDump, error) {
+	ch := make(chan dumpResult)
+	for _, node := range c.Nodes {
+		go func(node string) {
+			states, err := c.dumpFromNode(ctx, node)
+			ch <- dumpResult{States: states, Node: node, Err: err}
+		}(node)
+	}
+
+	var errs []error
+	dumps := make(map[string]*AddressDump)
+	for range c.Nodes {
+		res := <-ch
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("Node %s: %w", res.Node, res.Err))
+			continue
+		}
+
+		for addr, state := range res.States {
+			dump, ok := dumps[addr]
+			if !ok {
+				dump = &AddressDump{Address: addr, States: make(map[string]shared.NodeStateRes)}
+				dumps[addr] = dump
+			}
+
+			dump.States[res.Node] = state
+			if state.ValueVersion.Newer(dump.Latest) {
+				dump.Latest = state.ValueVersion
+			}
+		}
+	}
+
+	sorted := make([]AddressDump, 0, len(dumps))
+	for _, dump := range dumps {
+		sorted = append(sorted, *dump)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Address < sorted[j].Address
+	})
+
+	return sorted, errors.Join(errs...)
+}
+
+// AddressState is an address's state on one of its replicas, or the error reading it
+type AddressState struct {
+	Node  string
+	State shared.NodeStateRes
+	Err   error
+}
+
+// AddressStates asks each of addr's replicas for everything it stores at addr, including
+// pending values, in order of node ID
+func (c *Client) AddressStates(ctx context.Context, addr string) []AddressState {
+	replicas := c.replicaNodes(addr)
+	states := make([]AddressState, len(replicas))
+
+	wg := sync.WaitGroup{}
+	for i, node := range replicas {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			state, err := c.stateFromNode(ctx, addr, node)
+			states[i] = AddressState{Node: node, State: state, Err: err}
+		}(i, node)
+	}
+
+	wg.Wait()
+
+	return states
+}
+
+// NodeFlags returns the testing flags set on node
+func (c *Client) NodeFlags(ctx context.Context, node string) (shared.NodeFlags, error) {
+	resp, err := c.do(ctx, http.MethodGet, node, "/admin/flags", nil)
+	if err != nil {
+		return shared.NodeFlags{}, err
+	}
+	defer closeBody(resp)
+
+	return decodeFlags(resp)
+}
+
+// SetNodeFlags replaces the testing flags set on node, returning the flags it now has
+func (c *Client) SetNodeFlags(ctx context.Context, node string, flags shared.NodeFlags) (shared.NodeFlags, error) {
+	body, _ := json.Marshal(flags)
+	resp, err := c.do(ctx, http.MethodPost, node, "/admin/flags", bytes.NewReader(body))
+	if err != nil {
+		return shared.NodeFlags{}, err
+	}
+	defer closeBody(resp)
+
+	return decodeFlags(resp)
+}
+
+func decodeFlags(resp *http.Response) (shared.NodeFlags, error) {
+	if resp.StatusCode != http.StatusOK {
+		return shared.NodeFlags{}, shared.ReadError(resp)
+	}
+
+	var res shared.NodeFlags
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return shared.NodeFlags{}, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) statusFromNode(ctx context.Context, node string) (shared.NodeStatusRes, error) {
+	resp, err := c.do(ctx, http.MethodGet, node, "/status", nil)
+	if err != nil {
+		return shared.NodeStatusRes{}, err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return shared.NodeStatusRes{}, shared.ReadError(resp)
+	}
+
+	var res shared.NodeStatusRes
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return shared.NodeStatusRes{}, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) dumpFromNode(ctx context.Context, node string) (map[string]shared.NodeStateRes, error) {
+	resp, err := c.do(ctx, http.MethodGet, node, "/dump", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, shared.ReadError(resp)
+	}
+
+	var res shared.NodeDumpRes
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+
+	return res.States, nil
+}
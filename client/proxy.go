@@ -0,0 +1,180 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+)
+
+// Proxy serves a Client's reads and writes over HTTP, for callers that can't embed the client
+type Proxy struct {
+	Server *http.Server
+	Port   int
+	Client *Client
+}
+
+// DetailedReadRes is the response to a read with detail=true
+type DetailedReadRes struct {
+	shared.ValueVersion
+	Phases []Phase `json:"phases"`
+}
+
+// DetailedWriteRes is the response to a write or compare-and-swap with detail=true
+type DetailedWriteRes struct {
+	Phases []Phase `json:"phases"`
+}
+
+func NewProxy(c *Client, port int) *Proxy {
+	return &Proxy{
+		Port:   port,
+		Client: c,
+	}
+}
+
+// NewServer returns a server for the proxy on its port
+func (p *Proxy) NewServer() *http.Server {
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%d", p.Port),
+		Handler: p,
+	}
+}
+
+// StartHTTP serves the proxy until its server is closed. It uses p.Server if it's already set,
+// so the server can be closed from another goroutine without waiting for StartHTTP to set it.
+func (p *Proxy) StartHTTP() {
+	log.Printf("Running client %s on port %d\n", p.Client.ID, p.Port)
+	if p.Server == nil {
+		p.Server = p.NewServer()
+	}
+	server := p.Server
+
+	if err := server.ListenAndServe(); err != nil {
+		if err != http.ErrServerClosed {
+			log.Printf("Server shut down: %s\n", err.Error())
+		}
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Client %s received request: %s\n", p.Client.ID, r.URL.Path)
+
+	// With detail=true, successful responses include how each node responded
+	var trace *Trace
+	if r.URL.Query().Get("detail") == "true" {
+		trace = &Trace{}
+		r = r.WithContext(WithTrace(r.Context(), trace))
+	}
+
+	switch r.URL.Path {
+	case "/write":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := p.WriteResolver(w, r); err != nil {
+			shared.WriteError(w, err)
+			return
+		}
+
+		writeDetail(w, trace)
+
+		return
+	case "/cas":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := p.CASResolver(w, r); err != nil {
+			shared.WriteError(w, err)
+			return
+		}
+
+		writeDetail(w, trace)
+
+		return
+	case "/read":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		vv, err := p.ReadResolver(w, r)
+		if err != nil {
+			shared.WriteError(w, err)
+			return
+		}
+
+		var res interface{} = vv
+		if trace != nil {
+			res = DetailedReadRes{ValueVersion: vv, Phases: trace.Phases()}
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			shared.WriteError(w, err)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (p *Proxy) ReadResolver(w http.ResponseWriter, r *http.Request) (shared.ValueVersion, error) {
+	addr := r.URL.Query().Get("address")
+	consistency, err := ParseConsistency(r.URL.Query().Get("consistency"))
+	if err != nil {
+		return shared.ValueVersion{}, shared.BadRequest("%s", err)
+	}
+
+	opts := ReadOptions{Consistency: consistency}
+	if q := r.URL.Query().Get("quorum"); q != "" {
+		if opts.Quorum, err = ParseQuorum(q); err != nil {
+			return shared.ValueVersion{}, shared.BadRequest("%s", err)
+		}
+	}
+
+	return p.Client.ReadWithOptions(r.Context(), addr, opts)
+}
+
+func (p *Proxy) WriteResolver(w http.ResponseWriter, r *http.Request) error {
+	var req shared.WriteReq
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return shared.BadRequest("Invalid request body: %s", err)
+	}
+
+	var opts WriteOptions
+	if q := r.URL.Query().Get("quorum"); q != "" {
+		if opts.Quorum, err = ParseQuorum(q); err != nil {
+			return shared.BadRequest("%s", err)
+		}
+	}
+
+	return p.Client.WriteWithOptions(r.Context(), req.Address, req.Value, opts)
+}
+
+func (p *Proxy) CASResolver(w http.ResponseWriter, r *http.Request) error {
+	var req shared.CASReq
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return shared.BadRequest("Invalid request body: %s", err)
+	}
+
+	return p.Client.CompareAndSwap(r.Context(), req.Address, req.ExpectedVersion, req.Value)
+}
+
+// writeDetail responds to a successful write with its trace, if it asked for one
+func writeDetail(w http.ResponseWriter, trace *Trace) {
+	if trace == nil {
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(DetailedWriteRes{Phases: trace.Phases()}); err != nil {
+		shared.WriteError(w, err)
+	}
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/node"
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxy(t *testing.T) {
+	n1 := node.New(0, 8080, 3, 3)
+	n2 := node.New(1, 8081, 3, 3)
+	n3 := node.New(2, 8082, 3, 3)
+
+	c := New(localNodes(3, 8080))
+	p := NewProxy(c, 8070)
+
+	go n1.StartHTTP()
+	go n2.StartHTTP()
+	go n3.StartHTTP()
+	go p.StartHTTP()
+	waitForServers(t, 8080, 8081, 8082, 8070)
+
+	// Errors keep their status and code through the proxy
+	resp, err := http.Get(shared.CreateURL("localhost:8070", "/read?address=addr1"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.ErrorIs(t, shared.ReadError(resp), shared.ErrNotFound)
+
+	resp, err = http.Get(shared.CreateURL("localhost:8070", "/read?address=addr1&quorum=SOME"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	body, _ := json.Marshal(shared.WriteReq{Address: "addr1", Value: "val1"})
+	resp, err = http.Post(shared.CreateURL("localhost:8070", "/write"), "application/json", bytes.NewBuffer(body))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// A compare-and-swap against an old version conflicts
+	body, _ = json.Marshal(shared.CASReq{Address: "addr1", ExpectedVersion: 0, Value: "val2"})
+	resp, err = http.Post(shared.CreateURL("localhost:8070", "/cas"), "application/json", bytes.NewBuffer(body))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	var conflict *shared.ConflictError
+	assert.True(t, errors.As(shared.ReadError(resp), &conflict))
+	assert.Equal(t, 1, conflict.ObservedVersion)
+
+	resp, err = http.Get(shared.CreateURL("localhost:8070", "/read?address=addr1&consistency=linearizable"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var vv shared.ValueVersion
+	err = json.NewDecoder(resp.Body).Decode(&vv)
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", vv.Value)
+	assert.Equal(t, 1, vv.Version)
+
+	// detail=true includes how each node responded to each phase
+	body, _ = json.Marshal(shared.WriteReq{Address: "addr1", Value: "val2"})
+	resp, err = http.Post(shared.CreateURL("localhost:8070", "/write?detail=true&quorum=ALL"), "application/json", bytes.NewBuffer(body))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var writeRes DetailedWriteRes
+	err = json.NewDecoder(resp.Body).Decode(&writeRes)
+	assert.Nil(t, err)
+	assert.Len(t, writeRes.Phases, 2)
+	assert.Equal(t, "write", writeRes.Phases[0].Name)
+	assert.ElementsMatch(t, c.Nodes, writeRes.Phases[0].Acked())
+	assert.Equal(t, "confirm", writeRes.Phases[1].Name)
+	assert.ElementsMatch(t, c.Nodes, writeRes.Phases[1].Acked())
+
+	resp, err = http.Get(shared.CreateURL("localhost:8070", "/read?address=addr1&quorum=ALL&detail=true"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var readRes DetailedReadRes
+	err = json.NewDecoder(resp.Body).Decode(&readRes)
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", readRes.Value)
+	assert.Equal(t, 2, readRes.Version)
+	assert.Len(t, readRes.Phases, 1)
+	for _, res := range readRes.Phases[0].Nodes {
+		assert.Equal(t, OutcomeAck, res.Outcome)
+		assert.Equal(t, 2, res.Version)
+		assert.Greater(t, res.Latency, time.Duration(0))
+	}
+
+	n1.Server.Close()
+	n2.Server.Close()
+	n3.Server.Close()
+	p.Server.Close()
+	c.Close()
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Quorum is how many nodes have to ack an operation for it to succeed.
+// It is either ONE, QUORUM (a majority), ALL, or an exact number of nodes.
+type Quorum string
+
+const (
+	QuorumOne      Quorum = "ONE"
+	QuorumMajority Quorum = "QUORUM"
+	QuorumAll      Quorum = "ALL"
+)
+
+func ParseQuorum(s string) (Quorum, error) {
+	q := Quorum(strings.ToUpper(s))
+	switch q {
+	case QuorumOne, QuorumMajority, QuorumAll:
+		return q, nil
+	}
+
+	k, err := strconv.Atoi(s)
+	if err != nil || k < 1 {
+		return "", fmt.Errorf("Invalid quorum %s, expected ONE, QUORUM, ALL or a positive number", s)
+	}
+
+	return q, nil
+}
+
+// Threshold is the number of acks the quorum needs out of numNodes nodes
+func (q Quorum) Threshold(numNodes int) int {
+	switch q {
+	case QuorumOne:
+		return 1
+	case QuorumMajority, "":
+		return numNodes/2 + 1
+	case QuorumAll:
+		return numNodes
+	}
+
+	// Validated by ParseQuorum
+	k, _ := strconv.Atoi(string(q))
+	return k
+}
+
+// Option configures a Client
+type Option func(c *Client)
+
+// WithReadQuorum sets how many nodes a read has to hear from. Defaults to QUORUM.
+func WithReadQuorum(q Quorum) Option {
+	return func(c *Client) {
+		c.ReadQuorum = q
+	}
+}
+
+// WithNumReplicas sets how many nodes each address is replicated to, which has to match the
+// nodes' configuration. Defaults to every node.
+func WithNumReplicas(numReplicas int) Option {
+	return func(c *Client) {
+		c.NumReplicas = numReplicas
+	}
+}
+
+// WithWriteQuorum sets how many nodes have to ack each phase of a write. Defaults to QUORUM.
+func WithWriteQuorum(q Quorum) Option {
+	return func(c *Client) {
+		c.WriteQuorum = q
+	}
+}
+
+// validQuorum checks that q can be reached with numReplicas replicas. An empty quorum is a majority.
+func validQuorum(name string, q Quorum, numReplicas int) (Quorum, error) {
+	if q == "" {
+		return QuorumMajority, nil
+	}
+
+	q, err := ParseQuorum(string(q))
+	if err != nil {
+		return "", err
+	}
+	if q.Threshold(numReplicas) > numReplicas {
+		return "", fmt.Errorf("The %s quorum %s is larger than the %d replicas", name, q, numReplicas)
+	}
+
+	return q, nil
+}
+
+// checkQuorums warns about read and write quorums that can't be reached, or that don't overlap.
+// Quorums that don't overlap are allowed, but a read isn't guaranteed to see the latest write.
+func checkQuorums(r, w Quorum, numReplicas int) {
+	rt, wt := r.Threshold(numReplicas), w.Threshold(numReplicas)
+
+	if rt > numReplicas {
+		log.Printf("WARNING: read quorum %s is larger than the %d replicas, reads will always fail", r, numReplicas)
+	}
+	if wt > numReplicas {
+		log.Printf("WARNING: write quorum %s is larger than the %d replicas, writes will always fail", w, numReplicas)
+	}
+	if rt+wt <= numReplicas {
+		log.Printf("WARNING: read quorum %s (%d) + write quorum %s (%d) <= %d replicas, reads may not see the latest write", r, rt, w, wt, numReplicas)
+	}
+}
+
+// quorumCall calls call on every node in parallel, and returns as soon as need of the results
+// are ok, or as soon as enough have failed that need can't be reached.
+// The results of calls still in flight are sent on the returned channel as they come in.
+// It is closed once every call has returned.
+func quorumCall[T any](nodes []string, need int, call func(node string) T, ok func(res T) bool) ([]T, <-chan T) {
+	// Buffered so stragglers never block once nobody is listening
+	ch := make(chan T, len(nodes))
+	for _, node := range nodes {
+		go func(node string) {
+			ch <- call(node)
+		}(node)
+	}
+
+	var results []T
+	succeeded, failed := 0, 0
+	for len(results) < len(nodes) && succeeded < need && failed <= len(nodes)-need {
+		res := <-ch
+		results = append(results, res)
+		if ok(res) {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+
+	remaining := len(nodes) - len(results)
+	late := make(chan T, remaining)
+	go func() {
+		for i := 0; i < remaining; i++ {
+			late <- <-ch
+		}
+		close(late)
+	}()
+
+	return results, late
+}
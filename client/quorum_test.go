@@ -0,0 +1,31 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuorum(t *testing.T) {
+	q, err := ParseQuorum("one")
+	assert.Nil(t, err)
+	assert.Equal(t, QuorumOne, q)
+	q, err = ParseQuorum("QUORUM")
+	assert.Nil(t, err)
+	assert.Equal(t, QuorumMajority, q)
+	q, err = ParseQuorum("2")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, q.Threshold(5))
+
+	_, err = ParseQuorum("0")
+	assert.NotNil(t, err)
+	_, err = ParseQuorum("SOME")
+	assert.NotNil(t, err)
+}
+
+func TestQuorumThreshold(t *testing.T) {
+	assert.Equal(t, 1, QuorumOne.Threshold(5))
+	assert.Equal(t, 3, QuorumMajority.Threshold(5))
+	assert.Equal(t, 2, QuorumMajority.Threshold(3))
+	assert.Equal(t, 5, QuorumAll.Threshold(5))
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+)
+
+// RecoverPending resolves every pending write that has outlived the pending timeout on any node.
+// These are left behind when a client dies between writing and confirming. Each one is either
+// rolled forward to every replica, if some node confirmed it, or discarded everywhere.
+func (c *Client) RecoverPending(ctx context.Context) error {
+	pendingCh := make(chan []shared.PendingWrite)
+
+	for _, node := range c.Nodes {
+		go func(node string) {
+			pending, err := c.pendingFromNode(ctx, node)
+			if err != nil {
+				log.Printf("Error fetching pending writes from node %s: %s", node, err)
+			}
+			pendingCh <- pending
+		}(node)
+	}
+
+	// The same write is usually pending on several nodes
+	writes := make(map[shared.PendingWrite]bool)
+	for i := 0; i < len(c.Nodes); i++ {
+		for _, pending := range <-pendingCh {
+			writes[shared.PendingWrite{Address: pending.Address, WriteID: pending.WriteID}] = true
+		}
+	}
+
+	var failed int
+	for write := range writes {
+		if err := c.recoverWrite(ctx, write.Address, write.WriteID); err != nil {
+			log.Printf("Error recovering write %s to address %s: %s", write.WriteID, write.Address, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Failed to recover %d of %d pending writes", failed, len(writes))
+	}
+
+	return nil
+}
+
+// StartRecovery calls RecoverPending every interval until StopRecovery is called
+func (c *Client) StartRecovery(interval time.Duration) {
+	c.recoveryStop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		// Recovery in progress is cancelled when it's stopped
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-stop
+			cancel()
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := c.RecoverPending(ctx); err != nil {
+					log.Printf("Client %s failed to recover pending writes: %s", c.ID, err)
+				}
+			}
+		}
+	}(c.recoveryStop)
+}
+
+func (c *Client) StopRecovery() {
+	if c.recoveryStop != nil {
+		close(c.recoveryStop)
+		c.recoveryStop = nil
+	}
+}
+
+type stateResult struct {
+	State shared.NodeStateRes
+	Node  string
+	Err   error
+}
+
+// recoverWrite decides the outcome of the write writeID to addr.
+//
+// A write only succeeds once a write quorum of replicas have confirmed it. If more than
+// len(replicas) - WriteQuorum replicas respond, they share a node with every write quorum. So if
+// none of them confirmed the write, its writer can't have reported success, and it is safe
+// to discard. Writes that overrode the write quorum with a smaller one aren't covered.
+func (c *Client) recoverWrite(ctx context.Context, addr string, writeID string) error {
+	replicas := c.replicaNodes(addr)
+	ch := make(chan stateResult)
+
+	for _, node := range replicas {
+		go func(node string) {
+			state, err := c.stateFromNode(ctx, addr, node)
+			ch <- stateResult{State: state, Node: node, Err: err}
+		}(node)
+	}
+
+	var states []stateResult
+	var confirmed *shared.ValueVersion
+	for i := 0; i < len(replicas); i++ {
+		res := <-ch
+		if res.Err != nil {
+			log.Printf("Error reading state from node %s: %s", res.Node, res.Err)
+			continue
+		} else if !res.State.ShouldInclude {
+			continue
+		}
+
+		states = append(states, res)
+		if res.State.ValueVersion.WriteID == writeID {
+			vv := res.State.ValueVersion
+			confirmed = &vv
+		}
+	}
+
+	if len(states) < len(replicas)-c.WriteQuorum.Threshold(len(replicas))+1 {
+		return shared.QuorumFailed("Not enough valid responses to make quorum")
+	}
+
+	wg := sync.WaitGroup{}
+	for _, res := range states {
+		res := res
+
+		pendingHere := res.State.Pending != nil && res.State.Pending.WriteID == writeID
+		behind := confirmed != nil && confirmed.Newer(res.State.ValueVersion)
+		if !pendingHere && !behind {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if behind {
+				if _, err := c.updateNode(ctx, addr, *confirmed, res.Node); err != nil {
+					log.Printf("Error updating node %s: %s", res.Node, err)
+					return
+				}
+			}
+			if pendingHere {
+				if err := c.abortWithNode(ctx, addr, writeID, res.Node); err != nil {
+					log.Printf("Error aborting with node %s: %s", res.Node, err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if confirmed != nil {
+		log.Printf("Client %s rolled forward write %s to address %s with value %s and version %d", c.ID, writeID, addr, confirmed.Value, confirmed.Version)
+	} else {
+		log.Printf("Client %s discarded write %s to address %s", c.ID, writeID, addr)
+	}
+
+	return nil
+}
+
+func (c *Client) pendingFromNode(ctx context.Context, node string) ([]shared.PendingWrite, error) {
+	resp, err := c.do(ctx, http.MethodGet, node, "/pending", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, shared.ReadError(resp)
+	}
+
+	var res shared.NodePendingRes
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+
+	return res.Pending, nil
+}
+
+func (c *Client) stateFromNode(ctx context.Context, addr string, node string) (shared.NodeStateRes, error) {
+	resp, err := c.do(ctx, http.MethodGet, node, "/state?address="+url.QueryEscape(addr), nil)
+	if err != nil {
+		return shared.NodeStateRes{}, err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return shared.NodeStateRes{}, shared.ReadError(resp)
+	}
+
+	var res shared.NodeStateRes
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return shared.NodeStateRes{}, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+)
+
+// Trace records how each node responded to each quorum phase of the operations run with it.
+// Only responses that arrive before an operation returns are recorded.
+type Trace struct {
+	mu     sync.Mutex
+	phases []Phase
+}
+
+// Phase is one round of requests an operation sent to the replicas
+type Phase struct {
+	// Name is read, repair, write, confirm or abort
+	Name  string       `json:"name"`
+	Nodes []NodeResult `json:"nodes"`
+}
+
+// Acked returns the nodes that acked the phase
+func (p Phase) Acked() []string {
+	var acked []string
+	for _, res := range p.Nodes {
+		if res.Outcome == OutcomeAck {
+			acked = append(acked, res.Node)
+		}
+	}
+	return acked
+}
+
+// Outcome is how a node responded to a request
+type Outcome string
+
+const (
+	OutcomeAck Outcome = "ack"
+	// OutcomeRefused means the node responded, but rejected the request
+	OutcomeRefused Outcome = "refused"
+	// OutcomeNotReplica means the node doesn't store the address
+	OutcomeNotReplica Outcome = "not-a-replica"
+	// OutcomeError means the request failed without a response from the node, or the node
+	// failed internally
+	OutcomeError   Outcome = "error"
+	OutcomeTimeout Outcome = "timeout"
+	// OutcomeNoResponse means the phase reached or missed quorum before the node responded
+	OutcomeNoResponse Outcome = "no-response"
+)
+
+// NodeResult is how one node responded to one phase
+type NodeResult struct {
+	Node    string
+	Outcome Outcome
+	// Version is the version the node reported: the version read, or the version
+	// a compare-and-swap conflicted with
+	Version int
+	Latency time.Duration
+	Err     error
+}
+
+// nodeResultJSON is how a NodeResult is sent over HTTP
+type nodeResultJSON struct {
+	Node    string  `json:"node"`
+	Outcome Outcome `json:"outcome"`
+	Version int     `json:"version"`
+	Latency string  `json:"latency"`
+	Error   string  `json:"error,omitempty"`
+}
+
+func (res NodeResult) MarshalJSON() ([]byte, error) {
+	out := nodeResultJSON{
+		Node:    res.Node,
+		Outcome: res.Outcome,
+		Version: res.Version,
+		Latency: res.Latency.String(),
+	}
+	if res.Err != nil {
+		out.Error = res.Err.Error()
+	}
+
+	return json.Marshal(out)
+}
+
+func (res *NodeResult) UnmarshalJSON(data []byte) error {
+	var in nodeResultJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	latency, err := time.ParseDuration(in.Latency)
+	if err != nil {
+		return err
+	}
+
+	*res = NodeResult{
+		Node:    in.Node,
+		Outcome: in.Outcome,
+		Version: in.Version,
+		Latency: latency,
+	}
+	if in.Error != "" {
+		res.Err = errors.New(in.Error)
+	}
+
+	return nil
+}
+
+// newNodeResult classifies a node's response to a request that was sent at start
+func newNodeResult(node string, start time.Time, version int, shouldInclude bool, err error) NodeResult {
+	res := NodeResult{
+		Node:    node,
+		Outcome: OutcomeAck,
+		Version: version,
+		Latency: time.Since(start),
+		Err:     err,
+	}
+
+	// Nodes respond with typed errors when they refuse a request
+	var nodeErr *shared.Error
+	var conflict *shared.ConflictError
+	var netErr net.Error
+	if errors.As(err, &conflict) {
+		res.Outcome = OutcomeRefused
+		res.Version = conflict.ObservedVersion
+	} else if errors.As(err, &nodeErr) && nodeErr.Code != shared.CodeInternal {
+		res.Outcome = OutcomeRefused
+	} else if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		res.Outcome = OutcomeTimeout
+	} else if err != nil {
+		res.Outcome = OutcomeError
+	} else if !shouldInclude {
+		res.Outcome = OutcomeNotReplica
+	}
+
+	return res
+}
+
+// noResponse adds the replicas missing from results, which hadn't responded by the time
+// the phase finished
+func noResponse(replicas []string, results []NodeResult) []NodeResult {
+	responded := make(map[string]bool)
+	for _, res := range results {
+		responded[res.Node] = true
+	}
+
+	for _, node := range replicas {
+		if !responded[node] {
+			results = append(results, NodeResult{Node: node, Outcome: OutcomeNoResponse})
+		}
+	}
+
+	return results
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context that records the phases of the operations it's passed to in t
+func WithTrace(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// Phases returns the phases recorded so far, in the order they finished
+func (t *Trace) Phases() []Phase {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Phase(nil), t.phases...)
+}
+
+// Reset clears the recorded phases
+func (t *Trace) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.phases = nil
+}
+
+// recordPhase adds a phase to ctx's trace, if it has one
+func recordPhase(ctx context.Context, p Phase) {
+	t, ok := ctx.Value(traceKey{}).(*Trace)
+	if !ok || t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.phases = append(t.phases, p)
+}
+
+// cleanupContext returns a context for cleaning up after ctx, which isn't cancelled with it
+// but still records to its trace
+func cleanupContext(ctx context.Context) context.Context {
+	if t, ok := ctx.Value(traceKey{}).(*Trace); ok {
+		return WithTrace(context.Background(), t)
+	}
+
+	return context.Background()
+}
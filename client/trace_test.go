@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeResultOutcome(t *testing.T) {
+	start := time.Now()
+
+	assert.Equal(t, OutcomeAck, newNodeResult("n", start, 1, true, nil).Outcome)
+	assert.Equal(t, OutcomeNotReplica, newNodeResult("n", start, 0, false, nil).Outcome)
+	assert.Equal(t, OutcomeRefused, newNodeResult("n", start, 0, false, shared.Unavailable("Refusing to write because of testing flag")).Outcome)
+	assert.Equal(t, OutcomeTimeout, newNodeResult("n", start, 0, false, fmt.Errorf("Get: %w", context.DeadlineExceeded)).Outcome)
+	assert.Equal(t, OutcomeError, newNodeResult("n", start, 0, false, errors.New("connection refused")).Outcome)
+
+	res := newNodeResult("n", start, 0, true, &shared.ConflictError{Address: "addr1", ExpectedVersion: 1, ObservedVersion: 3})
+	assert.Equal(t, OutcomeRefused, res.Outcome)
+	assert.Equal(t, 3, res.Version)
+
+	results := noResponse([]string{"n1", "n2", "n3"}, []NodeResult{{Node: "n2", Outcome: OutcomeAck}})
+	assert.Len(t, results, 3)
+	assert.Equal(t, OutcomeNoResponse, results[1].Outcome)
+	assert.Equal(t, OutcomeNoResponse, results[2].Outcome)
+}
@@ -0,0 +1,126 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/client"
+	"github.com/shekarramaswamy4/shared-register-abstraction/config"
+	"github.com/shekarramaswamy4/shared-register-abstraction/node"
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+)
+
+// Cluster is a whole register running in one process: every node, and a client
+// with its HTTP proxy. It's meant for local development and integration tests.
+type Cluster struct {
+	Nodes  []*node.Node
+	Client *client.Client
+	// Proxy is nil if the configuration doesn't set the client's port
+	Proxy *client.Proxy
+
+	listeners []net.Listener
+}
+
+// Local returns the configuration for numNodes nodes on localhost, on consecutive ports
+// starting at firstPort, and a client proxy on clientPort
+func Local(numNodes int, numReplicas int, firstPort int, clientPort int) *config.Cluster {
+	addrs := make([]string, numNodes)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("localhost:%d", firstPort+i)
+	}
+
+	cfg := config.FromAddresses(addrs, numReplicas)
+	cfg.Client.Port = clientPort
+	return cfg
+}
+
+// Start boots every node in cfg and a client. Every node's address has to be on this machine.
+// Start returns once they all accept connections.
+func Start(cfg *config.Cluster) (*Cluster, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	c := &Cluster{}
+	for id, addr := range cfg.Addresses() {
+		port, err := shared.NodePort(addr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		n := node.New(id, port, len(cfg.Nodes), cfg.Replicas())
+		if cfg.PendingTimeout > 0 {
+			n.PendingTimeout = cfg.PendingTimeout
+		}
+
+		n.Server, err = c.serve(port, n)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("Failed to start node %d: %s", id, err)
+		}
+		c.Nodes = append(c.Nodes, n)
+	}
+
+	var err error
+	c.Client, err = client.Dial(cfg.ClientConfig())
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if cfg.Client.Port != 0 {
+		proxy := client.NewProxy(c.Client, cfg.Client.Port)
+		proxy.Server, err = c.serve(cfg.Client.Port, proxy)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("Failed to start client: %s", err)
+		}
+		c.Proxy = proxy
+	}
+
+	return c, nil
+}
+
+// serve listens on port before returning, so requests sent right away don't beat the listener
+func (c *Cluster) serve(port int, handler http.Handler) (*http.Server, error) {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	c.listeners = append(c.listeners, l)
+
+	server := &http.Server{Handler: handler}
+	go func() {
+		if err := server.Serve(l); err != http.ErrServerClosed {
+			log.Printf("Server on port %d shut down: %s\n", port, err)
+		}
+	}()
+
+	return server, nil
+}
+
+// Close stops the client and every node
+func (c *Cluster) Close() error {
+	var errs []error
+	if c.Proxy != nil {
+		errs = append(errs, c.Proxy.Server.Close())
+	}
+	if c.Client != nil {
+		errs = append(errs, c.Client.Close())
+	}
+	for _, n := range c.Nodes {
+		errs = append(errs, n.Server.Close(), n.Close())
+	}
+
+	// A server doesn't close its listener if it's closed before it starts serving.
+	// Listeners that were already closed by their server are fine to close again.
+	for _, l := range c.listeners {
+		l.Close()
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStart(t *testing.T) {
+	// Ports that don't clash with the client package's tests, which can run at the same time, or with
+	// the other tests here
+	c, err := Start(Local(3, 2, 9180, 9170))
+	assert.Nil(t, err)
+
+	err = c.Client.Write(context.Background(), "addr1", "val1")
+	assert.Nil(t, err)
+
+	resp, err := http.Get(shared.CreateURL("localhost:9170", "/read?address=addr1"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var vv shared.ValueVersion
+	err = json.NewDecoder(resp.Body).Decode(&vv)
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", vv.Value)
+	assert.Equal(t, 1, vv.Version)
+
+	err = c.Close()
+	assert.Nil(t, err)
+
+	// Every port is free again once the cluster is closed
+	c, err = Start(Local(3, 2, 9180, 9170))
+	assert.Nil(t, err)
+	assert.Nil(t, c.Close())
+}
+
+func TestStartPortInUse(t *testing.T) {
+	c, err := Start(Local(3, 3, 9200, 9171))
+	assert.Nil(t, err)
+	defer c.Close()
+
+	_, err = Start(Local(3, 3, 9202, 9173))
+	assert.NotNil(t, err)
+
+	// The nodes that did start were shut down again
+	other, err := Start(Local(1, 1, 9203, 0))
+	assert.Nil(t, err)
+	assert.Nil(t, other.Close())
+}
+
+func TestStartClientPortInUse(t *testing.T) {
+	l, err := net.Listen("tcp", ":9172")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	_, err = Start(Local(3, 3, 9190, 9172))
+	assert.NotNil(t, err)
+
+	// The nodes were shut down again
+	other, err := Start(Local(3, 3, 9190, 0))
+	assert.Nil(t, err)
+	assert.Nil(t, other.Close())
+}
@@ -1,42 +1,96 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
 
 	"github.com/shekarramaswamy4/shared-register-abstraction/client"
+	"github.com/shekarramaswamy4/shared-register-abstraction/config"
 )
 
 func main() {
-	// port, numNodes, firstNodePort
-	args := os.Args[1:]
-	port, err := strconv.Atoi(args[1])
-	if err != nil {
-		log.Fatalf("Invalid port number: %s", args[1])
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  client -config <cluster.yaml> [-port <port>] [flags]
+  client -nodes <host:port,host:port,...> -port <port> [-num-replicas <n>] [flags]
+
+Flags set on the command line override the cluster configuration.
+
+Flags:
+`)
+		flag.PrintDefaults()
 	}
 
-	numNodes, err := strconv.Atoi(args[2])
+	clusterFlags := config.RegisterFlags(flag.CommandLine)
+	port := flag.Int("port", 0, "port the HTTP proxy listens on")
+	recoveryInterval := flag.Duration("recovery-interval", 0, "how often to recover pending writes left behind by crashed clients; 0 disables recovery")
+	readQuorum := flag.String("read-quorum", string(client.QuorumMajority), "default number of nodes a read has to hear from: ONE, QUORUM, ALL or a number")
+	writeQuorum := flag.String("write-quorum", string(client.QuorumMajority), "default number of nodes that have to ack a write: ONE, QUORUM, ALL or a number")
+	timeout := flag.Duration("timeout", 0, "how long each request to a node can take; defaults to 3s")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		usageError(fmt.Errorf("Unexpected arguments: %v", flag.Args()))
+	}
+
+	cluster, err := clusterFlags.Cluster()
 	if err != nil {
-		log.Fatalf("Invalid number of nodes: %s", args[2])
+		usageError(err)
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cluster.Client.Port = *port
+		case "recovery-interval":
+			cluster.Client.RecoveryInterval = *recoveryInterval
+		case "read-quorum":
+			cluster.Client.ReadQuorum = *readQuorum
+		case "write-quorum":
+			cluster.Client.WriteQuorum = *writeQuorum
+		case "timeout":
+			cluster.Client.Timeout = *timeout
+		}
+	})
+
+	if cluster.Client.Port == 0 {
+		usageError(fmt.Errorf("-port is required unless the cluster configuration sets the client's port"))
 	}
-	if numNodes%2 == 0 {
-		log.Fatalf("Number of nodes must be odd")
+	if err := cluster.Validate(); err != nil {
+		usageError(err)
 	}
 
-	// For the purpose of this exercise assume that we can fetch
-	// the node ports deterministically from the first node port.
-	//
-	// We also assume that nodes neither enter or exit the system
-	//
-	// That is, if there are 3 numNodes, the first node's port will be firstNodePort
-	// and the second node's port will be firstNodePort + 1 and so on
-	firstNodePort, err := strconv.Atoi(args[3])
+	c, err := client.Dial(cluster.ClientConfig())
 	if err != nil {
-		log.Fatalf("Invalid first node port: %s", args[3])
+		log.Fatalf("Invalid client configuration: %s", err)
 	}
 
-	c := client.New(port, numNodes, firstNodePort)
+	p := client.NewProxy(c, cluster.Client.Port)
+
+	// Let background repairs finish before exiting. The server exists before the signal handler,
+	// so a signal that arrives before it starts serving still stops it.
+	p.Server = p.NewServer()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		p.Server.Close()
+	}()
+
+	p.StartHTTP()
+
+	if err := c.Close(); err != nil {
+		log.Printf("Failed to close client: %s", err)
+	}
+}
 
-	c.StartHTTP()
+// usageError reports a problem with the command line, and exits after printing usage
+func usageError(err error) {
+	fmt.Fprintf(flag.CommandLine.Output(), "%s\n\n", err)
+	flag.Usage()
+	os.Exit(2)
 }
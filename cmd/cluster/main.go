@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/cluster"
+	"github.com/shekarramaswamy4/shared-register-abstraction/config"
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  cluster [-num-nodes <n>] [-num-replicas <n>] [-first-port <port>] [-client-port <port>]
+  cluster -config <cluster.yaml>
+
+Runs every node and a client in this process until interrupted.
+
+Flags:
+`)
+		flag.PrintDefaults()
+	}
+
+	configPath := flag.String("config", "", "YAML or JSON cluster configuration file, instead of the other flags; every node has to be on this machine")
+	numNodes := flag.Int("num-nodes", 3, "number of nodes")
+	numReplicas := flag.Int("num-replicas", 0, "how many nodes each address is replicated to; defaults to every node")
+	firstPort := flag.Int("first-port", 8080, "port of the first node; the other nodes use the ports after it")
+	clientPort := flag.Int("client-port", 8070, "port of the client's HTTP proxy")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		usageError(fmt.Errorf("Unexpected arguments: %v", flag.Args()))
+	}
+
+	cfg := cluster.Local(*numNodes, *numReplicas, *firstPort, *clientPort)
+	if *configPath != "" {
+		// The configuration replaces the other flags, so they would be ignored
+		var ignored []string
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name != "config" {
+				ignored = append(ignored, "-"+f.Name)
+			}
+		})
+		if len(ignored) > 0 {
+			usageError(fmt.Errorf("%s can't be used with -config", strings.Join(ignored, " and ")))
+		}
+
+		var err error
+		if cfg, err = config.Load(*configPath); err != nil {
+			usageError(err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		usageError(err)
+	}
+
+	c, err := cluster.Start(cfg)
+	if err != nil {
+		log.Fatalf("Failed to start cluster: %s", err)
+	}
+
+	for id, addr := range cfg.Addresses() {
+		fmt.Printf("node %d: %s\n", id, shared.CreateURL(addr, ""))
+	}
+	if c.Proxy != nil {
+		fmt.Printf("client: %s\n", shared.CreateURL(fmt.Sprintf("localhost:%d", c.Proxy.Port), ""))
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+
+	log.Printf("Shutting down cluster")
+	if err := c.Close(); err != nil {
+		log.Fatalf("Failed to shut down cluster: %s", err)
+	}
+}
+
+// usageError reports a problem with the command line, and exits after printing usage
+func usageError(err error) {
+	fmt.Fprintf(flag.CommandLine.Output(), "%s\n\n", err)
+	flag.Usage()
+	os.Exit(2)
+}
@@ -1,37 +1,122 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/shekarramaswamy4/shared-register-abstraction/config"
 	"github.com/shekarramaswamy4/shared-register-abstraction/node"
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
 )
 
 func main() {
-	// port
-	args := os.Args[1:]
-	id, err := strconv.Atoi(args[1])
-	if err != nil {
-		log.Fatalf("Invalid id: %s", args[1])
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  node -config <cluster.yaml> -id <id> [flags]
+  node -nodes <host:port,host:port,...> -id <id> [-num-replicas <n>] [flags]
+
+Flags:
+`)
+		flag.PrintDefaults()
 	}
-	port, err := strconv.Atoi(args[2])
-	if err != nil {
-		log.Fatalf("Invalid port number: %s", args[2])
+
+	clusterFlags := config.RegisterFlags(flag.CommandLine)
+	id := flag.Int("id", -1, "this node's ID, which is its index in the cluster's nodes")
+	pendingTimeout := flag.Duration("pending-timeout", 0, "how long a pending value blocks other writes; overrides the cluster configuration, which defaults to 2s")
+	storageKind := flag.String("storage", "memory", "storage engine: memory, or log for an append-only log on disk")
+	logDir := flag.String("log-dir", "", "directory for the write-ahead log and snapshots used by -storage=log")
+	walSync := flag.String("wal-sync", string(node.SyncAlways), "when to fsync the write-ahead log: always, interval or never")
+	walSyncInterval := flag.Duration("wal-sync-interval", 100*time.Millisecond, "how often to fsync the write-ahead log when -wal-sync=interval")
+	snapshotPath := flag.String("snapshot", "", "where -storage=memory writes snapshots")
+	snapshotInterval := flag.Duration("snapshot-interval", 0, "how often to snapshot memory; 0 disables periodic snapshots")
+	restoreFrom := flag.String("restore-from", "", "snapshot to load before serving requests")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		usageError(fmt.Errorf("Unexpected arguments: %v", flag.Args()))
 	}
-	numNodes, err := strconv.Atoi(args[3])
+
+	cluster, err := clusterFlags.Cluster()
 	if err != nil {
-		log.Fatalf("Invalid num nodes: %s", args[3])
+		usageError(err)
+	}
+	if *id < 0 || *id >= len(cluster.Nodes) {
+		usageError(fmt.Errorf("-id must be between 0 and %d", len(cluster.Nodes)-1))
 	}
-	numReplicas, err := strconv.Atoi(args[4])
+
+	// The node listens on the port in its own address
+	port, err := shared.NodePort(cluster.Addresses()[*id])
 	if err != nil {
-		log.Fatalf("Invalid num replicas: %s", args[4])
+		usageError(err)
+	}
+
+	var storage node.Storage
+	switch *storageKind {
+	case "memory":
+		memory := node.NewMemoryStorage()
+		memory.SnapshotPath = *snapshotPath
+		storage = memory
+	case "log":
+		if *logDir == "" {
+			log.Fatalf("-storage=log requires -log-dir")
+		}
+		storage, err = node.OpenLogStorage(node.LogStorageConfig{
+			Dir:      *logDir,
+			Policy:   node.SyncPolicy(*walSync),
+			Interval: *walSyncInterval,
+		})
+		if err != nil {
+			log.Fatalf("Failed to open write-ahead log: %s", err)
+		}
+	default:
+		log.Fatalf("Invalid storage engine: %s", *storageKind)
 	}
 
-	n := node.New(id, port, numNodes, numReplicas)
+	n := node.NewWithStorage(*id, port, len(cluster.Nodes), cluster.Replicas(), storage)
+	if *pendingTimeout > 0 {
+		n.PendingTimeout = *pendingTimeout
+	} else if cluster.PendingTimeout > 0 {
+		n.PendingTimeout = cluster.PendingTimeout
+	}
+
+	if *restoreFrom != "" {
+		if err := n.Restore(*restoreFrom); err != nil {
+			log.Fatalf("Failed to restore from snapshot: %s", err)
+		}
+	}
+
+	if *snapshotInterval > 0 {
+		n.StartSnapshots(*snapshotInterval)
+	}
+
+	// Close storage before exiting so nothing buffered is lost. The server exists before the
+	// signal handler, so a signal that arrives before it starts serving still stops it.
+	n.Server = n.NewServer()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		n.Server.Close()
+	}()
 
 	// OPTIMIZATION: gossip with other nodes to get up to date when boostrapping?
 	// should know the possible address space ahead of time
 
 	n.StartHTTP()
+
+	if err := n.Close(); err != nil {
+		log.Printf("Failed to close node: %s", err)
+	}
+}
+
+// usageError reports a problem with the command line, and exits after printing usage
+func usageError(err error) {
+	fmt.Fprintf(flag.CommandLine.Output(), "%s\n\n", err)
+	flag.Usage()
+	os.Exit(2)
 }
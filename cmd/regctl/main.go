@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/client"
+	"github.com/shekarramaswamy4/shared-register-abstraction/config"
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+)
+
+const usage = `Usage:
+  regctl [flags] <command> [arguments]
+
+Commands:
+  get <address>                             read an address
+  put <address> <value>                     write an address
+  cas <address> <expected-version> <value>  write an address only if it's at expected-version
+  watch [-interval <duration>] <address>    print an address whenever its version changes
+  dump                                      list every address on every node
+  node-status                               show every node's status
+
+regctl talks to the nodes directly with -config or -nodes, or through a client's HTTP proxy
+with -client. dump and node-status need the nodes.
+
+Flags:
+`
+
+// ctl holds what every command needs
+type ctl struct {
+	register register
+	// client is nil when going through a proxy
+	client *client.Client
+	json   bool
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	clusterFlags := config.RegisterFlags(flag.CommandLine)
+	proxyAddr := flag.String("client", "", "address of a client's HTTP proxy, as host:port or a URL, instead of -config or -nodes")
+	output := flag.String("o", "text", "output format: text or json")
+	timeout := flag.Duration("timeout", 10*time.Second, "how long a command can take; watch applies it to each read")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usageError(errors.New("A command is required"))
+	}
+	if *output != "text" && *output != "json" {
+		usageError(fmt.Errorf("Invalid output format %s", *output))
+	}
+
+	c := &ctl{json: *output == "json"}
+	if *proxyAddr != "" {
+		if err := shared.ValidateNodeAddr(*proxyAddr); err != nil {
+			usageError(err)
+		}
+		c.register = &proxy{addr: *proxyAddr}
+	} else {
+		cluster, err := clusterFlags.Cluster()
+		if err != nil {
+			usageError(err)
+		}
+
+		if c.client, err = client.Dial(cluster.ClientConfig()); err != nil {
+			usageError(err)
+		}
+		defer c.client.Close()
+		c.register = c.client
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	if err := c.run(ctx, cmd, args, *timeout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		if c.client != nil {
+			c.client.Close()
+		}
+		os.Exit(1)
+	}
+}
+
+func (c *ctl) run(ctx context.Context, cmd string, args []string, timeout time.Duration) error {
+	// watch runs until it's interrupted, so only its reads are bounded
+	if cmd == "watch" {
+		return c.watch(ctx, args, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch cmd {
+	case "get":
+		if len(args) != 1 {
+			usageError(errors.New("get takes an address"))
+		}
+		return c.get(ctx, args[0])
+	case "put":
+		if len(args) != 2 {
+			usageError(errors.New("put takes an address and a value"))
+		}
+		return c.put(ctx, args[0], args[1])
+	case "cas":
+		if len(args) != 3 {
+			usageError(errors.New("cas takes an address, the expected version and a value"))
+		}
+		expectedVersion, err := strconv.Atoi(args[1])
+		if err != nil {
+			usageError(fmt.Errorf("Invalid expected version %s", args[1]))
+		}
+		return c.cas(ctx, args[0], expectedVersion, args[2])
+	case "dump":
+		return c.dump(ctx)
+	case "node-status":
+		return c.nodeStatus(ctx)
+	}
+
+	usageError(fmt.Errorf("Unknown command %s", cmd))
+	return nil
+}
+
+type valueOutput struct {
+	Address string    `json:"address"`
+	Value   string    `json:"value"`
+	Version int       `json:"version"`
+	Time    time.Time `json:"time,omitempty"`
+	// Written is when the value was committed, if the nodes recorded it
+	Written *time.Time `json:"written,omitempty"`
+}
+
+func readOutput(addr string, vv shared.ValueVersion) valueOutput {
+	out := valueOutput{Address: addr, Value: vv.Value, Version: vv.Version}
+	if !vv.Timestamp.IsZero() {
+		written := vv.Timestamp.Time()
+		out.Written = &written
+	}
+	return out
+}
+
+// describe formats the version of a value that was read, and when it was written
+func (out valueOutput) describe() string {
+	if out.Written == nil {
+		return fmt.Sprintf("version %d", out.Version)
+	}
+	return fmt.Sprintf("version %d, written %s", out.Version, out.Written.Format(time.RFC3339Nano))
+}
+
+func (c *ctl) get(ctx context.Context, addr string) error {
+	vv, err := c.register.Read(ctx, addr)
+	if err != nil {
+		return err
+	}
+
+	out := readOutput(addr, vv)
+	c.print(out, func() {
+		fmt.Printf("%s = %s (%s)\n", addr, vv.Value, out.describe())
+	})
+	return nil
+}
+
+func (c *ctl) put(ctx context.Context, addr string, val string) error {
+	if err := c.register.Write(ctx, addr, val); err != nil {
+		return err
+	}
+
+	c.print(map[string]string{"address": addr, "value": val}, func() {
+		fmt.Printf("%s = %s\n", addr, val)
+	})
+	return nil
+}
+
+func (c *ctl) cas(ctx context.Context, addr string, expectedVersion int, val string) error {
+	if err := c.register.CompareAndSwap(ctx, addr, expectedVersion, val); err != nil {
+		return err
+	}
+
+	c.print(valueOutput{Address: addr, Value: val, Version: expectedVersion + 1}, func() {
+		fmt.Printf("%s = %s (version %d)\n", addr, val, expectedVersion+1)
+	})
+	return nil
+}
+
+func (c *ctl) watch(ctx context.Context, args []string, timeout time.Duration) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", time.Second, "how often to read the address")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usageError(errors.New("watch takes an address"))
+	}
+	addr := fs.Arg(0)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	last := shared.ValueVersion{Version: -1}
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, timeout)
+		vv, err := c.register.Read(readCtx, addr)
+		cancel()
+
+		if ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			// Keep watching through errors, since the address may not be written yet
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		} else if vv != last {
+			last = vv
+			now := time.Now()
+			out := readOutput(addr, vv)
+			out.Time = now
+			c.print(out, func() {
+				fmt.Printf("%s %s = %s (%s)\n", now.Format(time.RFC3339), addr, vv.Value, out.describe())
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+type dumpOutput struct {
+	Address string                         `json:"address"`
+	Latest  shared.ValueVersion            `json:"latest"`
+	Nodes   map[string]shared.NodeStateRes `json:"nodes"`
+}
+
+func (c *ctl) dump(ctx context.Context) error {
+	if c.client == nil {
+		return errors.New("dump talks to the nodes directly, use -config or -nodes")
+	}
+
+	// Print what could be collected even if some nodes are down
+	dumps, err := c.client.Dump(ctx)
+
+	out := make([]dumpOutput, 0, len(dumps))
+	for _, d := range dumps {
+		out = append(out, dumpOutput{Address: d.Address, Latest: d.Latest, Nodes: d.States})
+	}
+
+	c.print(out, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ADDRESS\tVALUE\tVERSION\tWRITTEN\tUP TO DATE\tPENDING")
+		for _, d := range dumps {
+			upToDate, pending := 0, 0
+			for _, state := range d.States {
+				if state.ValueVersion == d.Latest {
+					upToDate++
+				}
+				if state.Pending != nil {
+					pending++
+				}
+			}
+			written := "-"
+			if out := readOutput(d.Address, d.Latest); out.Written != nil {
+				written = out.Written.Format(time.RFC3339Nano)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d/%d\t%d\n", d.Address, d.Latest.Value, d.Latest.Version, written, upToDate, len(d.States), pending)
+		}
+		w.Flush()
+	})
+
+	return err
+}
+
+type nodeStatusOutput struct {
+	Node string `json:"node"`
+	shared.NodeStatusRes
+	Error string `json:"error,omitempty"`
+}
+
+func (c *ctl) nodeStatus(ctx context.Context) error {
+	if c.client == nil {
+		return errors.New("node-status talks to the nodes directly, use -config or -nodes")
+	}
+
+	statuses := c.client.NodeStatuses(ctx)
+
+	var down int
+	out := make([]nodeStatusOutput, 0, len(statuses))
+	for _, s := range statuses {
+		o := nodeStatusOutput{Node: s.Node, NodeStatusRes: s.Status}
+		if s.Err != nil {
+			o.Error = s.Err.Error()
+			down++
+		}
+		out = append(out, o)
+	}
+
+	c.print(out, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NODE\tSTATUS\tID\tREPLICAS\tADDRESSES\tPENDING")
+		for _, o := range out {
+			if o.Error != "" {
+				fmt.Fprintf(w, "%s\tdown: %s\t\t\t\t\n", o.Node, o.Error)
+				continue
+			}
+			fmt.Fprintf(w, "%s\tup\t%d\t%d/%d\t%d\t%d\n", o.Node, o.ID, o.NumReplicas, o.TotalNodes, o.Addresses, o.Pending)
+		}
+		w.Flush()
+	})
+
+	if down > 0 {
+		return fmt.Errorf("%d of %d nodes are down", down, len(statuses))
+	}
+
+	return nil
+}
+
+// print writes v as JSON in json mode, and calls text otherwise
+func (c *ctl) print(v interface{}, text func()) {
+	if !c.json {
+		text()
+		return
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+}
+
+// usageError reports a problem with the command line, and exits after printing usage
+func usageError(err error) {
+	fmt.Fprintf(flag.CommandLine.Output(), "%s\n\n", err)
+	flag.Usage()
+	os.Exit(2)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+)
+
+// register is what regctl needs to read and write. *client.Client talks to the nodes directly,
+// and proxy goes through a client's HTTP proxy.
+type register interface {
+	Read(ctx context.Context, addr string) (shared.ValueVersion, error)
+	Write(ctx context.Context, addr string, val string) error
+	CompareAndSwap(ctx context.Context, addr string, expectedVersion int, val string) error
+}
+
+// proxy talks to the HTTP proxy served by cmd/client
+type proxy struct {
+	addr       string
+	httpClient http.Client
+}
+
+func (p *proxy) Read(ctx context.Context, addr string) (shared.ValueVersion, error) {
+	resp, err := p.do(ctx, http.MethodGet, "/read?address="+url.QueryEscape(addr), nil)
+	if err != nil {
+		return shared.ValueVersion{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return shared.ValueVersion{}, shared.ReadError(resp)
+	}
+
+	var vv shared.ValueVersion
+	if err := json.NewDecoder(resp.Body).Decode(&vv); err != nil {
+		return shared.ValueVersion{}, err
+	}
+
+	return vv, nil
+}
+
+func (p *proxy) Write(ctx context.Context, addr string, val string) error {
+	body, _ := json.Marshal(shared.WriteReq{
+		Address: addr,
+		Value:   val,
+	})
+	resp, err := p.do(ctx, http.MethodPost, "/write", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return shared.ReadError(resp)
+	}
+
+	return nil
+}
+
+func (p *proxy) CompareAndSwap(ctx context.Context, addr string, expectedVersion int, val string) error {
+	body, _ := json.Marshal(shared.CASReq{
+		Address:         addr,
+		ExpectedVersion: expectedVersion,
+		Value:           val,
+	})
+	resp, err := p.do(ctx, http.MethodPost, "/cas", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return shared.ReadError(resp)
+	}
+
+	return nil
+}
+
+func (p *proxy) do(ctx context.Context, method string, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, shared.CreateURL(p.addr, path), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return p.httpClient.Do(req)
+}
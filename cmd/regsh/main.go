@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/client"
+	"github.com/shekarramaswamy4/shared-register-abstraction/config"
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+)
+
+const help = `Commands:
+  get <address> [quorum]                    read an address, optionally with a read quorum
+  put <address> <value>                     write an address
+  cas <address> <expected-version> <value>  write an address only if it's at expected-version
+  state <address>                           show what each replica stores at an address
+  dump                                      list every address on every node
+  nodes                                     show every node's status and testing flags
+  refuse <node> <ops...>                    make a node refuse read, write, confirm, abort or update
+  allow <node> [ops...]                     stop a node refusing the given ops, or all of them
+  trace on|off                              show how each node responded to each phase of get, put and cas
+  help                                      show this message
+  quit                                      exit
+
+Nodes are given by ID or address.
+`
+
+// shell runs commands against a cluster through a client
+type shell struct {
+	client  *client.Client
+	out     io.Writer
+	timeout time.Duration
+	trace   bool
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  regsh -config <cluster.yaml> [flags]
+  regsh -nodes <host:port,host:port,...> [-num-replicas <n>] [flags]
+
+Flags:
+`)
+		flag.PrintDefaults()
+	}
+
+	clusterFlags := config.RegisterFlags(flag.CommandLine)
+	timeout := flag.Duration("timeout", 10*time.Second, "how long each command can take")
+	recoveryInterval := flag.Duration("recovery-interval", 0, "how often to recover pending writes left behind by crashed clients; 0 disables recovery, so it doesn't resolve the pending writes being inspected")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		usageError(fmt.Errorf("Unexpected arguments: %v", flag.Args()))
+	}
+
+	cluster, err := clusterFlags.Cluster()
+	if err != nil {
+		usageError(err)
+	}
+
+	// The cluster's recovery interval is for clients serving traffic, not for debugging
+	cfg := cluster.ClientConfig()
+	cfg.RecoveryInterval = *recoveryInterval
+
+	c, err := client.Dial(cfg)
+	if err != nil {
+		usageError(err)
+	}
+	defer c.Close()
+
+	s := &shell{client: c, out: os.Stdout, timeout: *timeout, trace: true}
+	fmt.Fprintf(s.out, "Connected to %d nodes with %d replicas per address. Type help for commands.\n", len(c.Nodes), c.NumReplicas)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprint(s.out, "regsh> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "exit" {
+			return
+		}
+
+		if err := s.run(args[0], args[1:]); err != nil {
+			fmt.Fprintf(s.out, "Error: %s\n", err)
+		}
+	}
+}
+
+func (s *shell) run(cmd string, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	switch cmd {
+	case "get":
+		if len(args) != 1 && len(args) != 2 {
+			return errors.New("get takes an address and optionally a quorum")
+		}
+		return s.get(ctx, args)
+	case "put":
+		if len(args) < 2 {
+			return errors.New("put takes an address and a value")
+		}
+		return s.put(ctx, args[0], strings.Join(args[1:], " "))
+	case "cas":
+		if len(args) < 3 {
+			return errors.New("cas takes an address, the expected version and a value")
+		}
+		expectedVersion, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("Invalid expected version %s", args[1])
+		}
+		return s.cas(ctx, args[0], expectedVersion, strings.Join(args[2:], " "))
+	case "state":
+		if len(args) != 1 {
+			return errors.New("state takes an address")
+		}
+		s.state(ctx, args[0])
+		return nil
+	case "dump":
+		return s.dump(ctx)
+	case "nodes":
+		s.nodes(ctx)
+		return nil
+	case "refuse":
+		if len(args) < 2 {
+			return errors.New("refuse takes a node and the ops to refuse")
+		}
+		return s.setFlags(ctx, args[0], args[1:], true)
+	case "allow":
+		if len(args) < 1 {
+			return errors.New("allow takes a node and optionally the ops to allow")
+		}
+		return s.setFlags(ctx, args[0], args[1:], false)
+	case "trace":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			return errors.New("trace takes on or off")
+		}
+		s.trace = args[0] == "on"
+		return nil
+	case "help":
+		fmt.Fprint(s.out, help)
+		return nil
+	}
+
+	return fmt.Errorf("Unknown command %s, type help for commands", cmd)
+}
+
+func (s *shell) get(ctx context.Context, args []string) error {
+	var opts client.ReadOptions
+	if len(args) == 2 {
+		q, err := client.ParseQuorum(args[1])
+		if err != nil {
+			return err
+		}
+		opts.Quorum = q
+	}
+
+	trace := &client.Trace{}
+	vv, err := s.client.ReadWithOptions(client.WithTrace(ctx, trace), args[0], opts)
+	s.printTrace(trace)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.out, "%s = %s (version %d, written %s)\n", args[0], vv.Value, vv.Version, written(vv))
+	return nil
+}
+
+func (s *shell) put(ctx context.Context, addr string, val string) error {
+	trace := &client.Trace{}
+	err := s.client.Write(client.WithTrace(ctx, trace), addr, val)
+	s.printTrace(trace)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(s.out, "OK")
+	return nil
+}
+
+func (s *shell) cas(ctx context.Context, addr string, expectedVersion int, val string) error {
+	trace := &client.Trace{}
+	err := s.client.CompareAndSwap(client.WithTrace(ctx, trace), addr, expectedVersion, val)
+	s.printTrace(trace)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.out, "OK, %s is at version %d\n", addr, expectedVersion+1)
+	return nil
+}
+
+func (s *shell) state(ctx context.Context, addr string) {
+	w := tabwriter.NewWriter(s.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tVALUE\tVERSION\tCONFIRMED BY\tWRITTEN\tPENDING\tPENDING SINCE\tPENDING WRITE")
+	for _, st := range s.client.AddressStates(ctx, addr) {
+		if st.Err != nil {
+			fmt.Fprintf(w, "%s\terror: %s\t\t\t\t\t\t\n", st.Node, st.Err)
+			continue
+		}
+
+		vv := st.State.ValueVersion
+		pending, since, writeID := "-", "-", "-"
+		if p := st.State.Pending; p != nil {
+			pending, since, writeID = p.Value, p.Timestamp.Format(time.RFC3339Nano), p.WriteID
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", st.Node, vv.Value, vv.Version, orDash(vv.WriteID), written(vv), pending, since, writeID)
+	}
+	w.Flush()
+}
+
+func (s *shell) dump(ctx context.Context) error {
+	dumps, err := s.client.Dump(ctx)
+
+	w := tabwriter.NewWriter(s.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDRESS\tNODE\tVALUE\tVERSION\tPENDING")
+	for _, d := range dumps {
+		for _, node := range s.inNodeOrder(keys(d.States)) {
+			st := d.States[node]
+			pending := "-"
+			if st.Pending != nil {
+				pending = fmt.Sprintf("%s (%s)", st.Pending.Value, st.Pending.WriteID)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", d.Address, node, st.ValueVersion.Value, st.ValueVersion.Version, pending)
+		}
+	}
+	w.Flush()
+
+	return err
+}
+
+func (s *shell) nodes(ctx context.Context) {
+	w := tabwriter.NewWriter(s.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNODE\tSTATUS\tADDRESSES\tPENDING\tREFUSING")
+	for i, st := range s.client.NodeStatuses(ctx) {
+		if st.Err != nil {
+			fmt.Fprintf(w, "%d\t%s\tdown: %s\t\t\t\n", i, st.Node, st.Err)
+			continue
+		}
+
+		refusing := "-"
+		if flags, err := s.client.NodeFlags(ctx, st.Node); err != nil {
+			refusing = "error: " + err.Error()
+		} else if ops := refusedOps(flags); len(ops) > 0 {
+			refusing = strings.Join(ops, ",")
+		}
+		fmt.Fprintf(w, "%d\t%s\tup\t%d\t%d\t%s\n", i, st.Node, st.Status.Addresses, st.Status.Pending, refusing)
+	}
+	w.Flush()
+}
+
+// setFlags makes node refuse or allow the given ops. Allowing no ops allows all of them.
+func (s *shell) setFlags(ctx context.Context, ref string, ops []string, refuse bool) error {
+	node, err := s.node(ref)
+	if err != nil {
+		return err
+	}
+
+	flags, err := s.client.NodeFlags(ctx, node)
+	if err != nil {
+		return err
+	}
+
+	if !refuse && len(ops) == 0 {
+		flags = shared.NodeFlags{}
+	}
+	for _, op := range ops {
+		switch op {
+		case "read":
+			flags.RefuseRead = refuse
+		case "write":
+			flags.RefuseWrite = refuse
+		case "confirm":
+			flags.RefuseConfirm = refuse
+		case "abort":
+			flags.RefuseAbort = refuse
+		case "update":
+			flags.RefuseUpdate = refuse
+		default:
+			return fmt.Errorf("Unknown op %s, expected read, write, confirm, abort or update", op)
+		}
+	}
+
+	flags, err = s.client.SetNodeFlags(ctx, node, flags)
+	if err != nil {
+		return err
+	}
+
+	if ops := refusedOps(flags); len(ops) > 0 {
+		fmt.Fprintf(s.out, "%s refuses %s\n", node, strings.Join(ops, ", "))
+	} else {
+		fmt.Fprintf(s.out, "%s refuses nothing\n", node)
+	}
+	return nil
+}
+
+// printTrace shows how each node responded to each phase of an operation, if tracing is on
+func (s *shell) printTrace(trace *client.Trace) {
+	if !s.trace {
+		return
+	}
+
+	ids := s.nodeIDs()
+	w := tabwriter.NewWriter(s.out, 0, 4, 2, ' ', 0)
+	for _, phase := range trace.Phases() {
+		results := append([]client.NodeResult(nil), phase.Nodes...)
+		sort.Slice(results, func(i, j int) bool {
+			return ids[results[i].Node] < ids[results[j].Node]
+		})
+
+		name := phase.Name
+		for _, res := range results {
+			version, latency, errMsg := "-", "-", ""
+			if res.Version > 0 {
+				version = fmt.Sprintf("v%d", res.Version)
+			}
+			if res.Outcome != client.OutcomeNoResponse {
+				latency = res.Latency.Round(time.Microsecond).String()
+			}
+			if res.Err != nil {
+				errMsg = res.Err.Error()
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\n", name, res.Node, res.Outcome, version, latency, errMsg)
+			name = ""
+		}
+	}
+	w.Flush()
+}
+
+// node resolves a node given by ID or address
+func (s *shell) node(ref string) (string, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		if id < 0 || id >= len(s.client.Nodes) {
+			return "", fmt.Errorf("Node ID %d is out of range, there are %d nodes", id, len(s.client.Nodes))
+		}
+		return s.client.Nodes[id], nil
+	}
+
+	for _, node := range s.client.Nodes {
+		if node == ref {
+			return node, nil
+		}
+	}
+
+	return "", fmt.Errorf("Unknown node %s", ref)
+}
+
+// inNodeOrder sorts nodes by node ID
+func (s *shell) inNodeOrder(nodes []string) []string {
+	ids := s.nodeIDs()
+	sorted := append([]string(nil), nodes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return ids[sorted[i]] < ids[sorted[j]]
+	})
+
+	return sorted
+}
+
+func (s *shell) nodeIDs() map[string]int {
+	ids := make(map[string]int)
+	for i, node := range s.client.Nodes {
+		ids[node] = i
+	}
+	return ids
+}
+
+func keys[V any](m map[string]V) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+func refusedOps(f shared.NodeFlags) []string {
+	var ops []string
+	if f.RefuseRead {
+		ops = append(ops, "read")
+	}
+	if f.RefuseWrite {
+		ops = append(ops, "write")
+	}
+	if f.RefuseConfirm {
+		ops = append(ops, "confirm")
+	}
+	if f.RefuseAbort {
+		ops = append(ops, "abort")
+	}
+	if f.RefuseUpdate {
+		ops = append(ops, "update")
+	}
+	return ops
+}
+
+// written returns when vv was committed, or "-" if the nodes didn't record it
+func written(vv shared.ValueVersion) string {
+	if vv.Timestamp.IsZero() {
+		return "-"
+	}
+	return vv.Timestamp.Time().Format(time.RFC3339Nano)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// usageError reports a problem with the command line, and exits after printing usage
+func usageError(err error) {
+	fmt.Fprintf(flag.CommandLine.Output(), "%s\n\n", err)
+	flag.Usage()
+	os.Exit(2)
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/client"
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+	"gopkg.in/yaml.v3"
+)
+
+// Cluster describes a cluster's nodes and clients. Every node and client in a cluster
+// has to be started with the same configuration.
+type Cluster struct {
+	// Nodes lists every node. IDs run from 0 to len(Nodes)-1.
+	Nodes []Node `yaml:"nodes"`
+	// NumReplicas is how many nodes each address is replicated to. Defaults to every node.
+	NumReplicas int `yaml:"numReplicas"`
+	// PendingTimeout is how long a pending value blocks other writes. Defaults to 2s.
+	PendingTimeout time.Duration `yaml:"pendingTimeout"`
+
+	Client Client `yaml:"client"`
+}
+
+type Node struct {
+	ID int `yaml:"id"`
+	// Address is host:port, or a URL such as https://host:port. The node listens on its port.
+	Address string `yaml:"address"`
+}
+
+// Client holds the client's defaults, which cmd/client's flags override
+type Client struct {
+	// Port is where cmd/client serves its HTTP proxy
+	Port             int           `yaml:"port"`
+	ReadQuorum       string        `yaml:"readQuorum"`
+	WriteQuorum      string        `yaml:"writeQuorum"`
+	Timeout          time.Duration `yaml:"timeout"`
+	RecoveryInterval time.Duration `yaml:"recoveryInterval"`
+}
+
+// Load reads and validates the cluster configuration at path, which is YAML or JSON.
+// Durations are strings such as "2s".
+func Load(path string) (*Cluster, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c Cluster
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&c); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", path, err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// FromAddresses creates a cluster with the given node addresses, in order of node ID
+func FromAddresses(addrs []string, numReplicas int) *Cluster {
+	c := &Cluster{NumReplicas: numReplicas}
+	for i, addr := range addrs {
+		c.Nodes = append(c.Nodes, Node{ID: i, Address: addr})
+	}
+
+	return c
+}
+
+// Validate checks that every node and client can be started with c
+func (c *Cluster) Validate() error {
+	numNodes := len(c.Nodes)
+	if numNodes == 0 {
+		return errors.New("At least one node is required")
+	}
+	if numNodes%2 == 0 {
+		return fmt.Errorf("Number of nodes must be odd, got %d", numNodes)
+	}
+
+	ids := make(map[int]bool)
+	addrs := make(map[string]bool)
+	for _, n := range c.Nodes {
+		if n.ID < 0 || n.ID >= numNodes {
+			return fmt.Errorf("Node IDs must be between 0 and %d, got %d", numNodes-1, n.ID)
+		}
+		if ids[n.ID] {
+			return fmt.Errorf("Node ID %d is used more than once", n.ID)
+		}
+		ids[n.ID] = true
+
+		if _, err := shared.NodePort(n.Address); err != nil {
+			return fmt.Errorf("Node %d: %s", n.ID, err)
+		}
+		if addrs[n.Address] {
+			return fmt.Errorf("Node address %s is used more than once", n.Address)
+		}
+		addrs[n.Address] = true
+	}
+
+	if c.NumReplicas != 0 && (c.NumReplicas < numNodes/2+1 || c.NumReplicas > numNodes) {
+		return fmt.Errorf("Number of replicas must be between %d and %d, got %d", numNodes/2+1, numNodes, c.NumReplicas)
+	}
+	if c.PendingTimeout < 0 {
+		return fmt.Errorf("Pending timeout must not be negative, got %v", c.PendingTimeout)
+	}
+	if c.Client.Port < 0 || c.Client.Port > 65535 {
+		return fmt.Errorf("Invalid client port %d", c.Client.Port)
+	}
+
+	return c.ClientConfig().Validate()
+}
+
+// Addresses returns every node's address, in order of node ID
+func (c *Cluster) Addresses() []string {
+	addrs := make([]string, len(c.Nodes))
+	for _, n := range c.Nodes {
+		addrs[n.ID] = n.Address
+	}
+
+	return addrs
+}
+
+// Replicas returns NumReplicas, or the number of nodes if it isn't set
+func (c *Cluster) Replicas() int {
+	if c.NumReplicas == 0 {
+		return len(c.Nodes)
+	}
+
+	return c.NumReplicas
+}
+
+// ClientConfig returns the configuration for a client of the cluster
+func (c *Cluster) ClientConfig() client.Config {
+	return client.Config{
+		Nodes:            c.Addresses(),
+		NumReplicas:      c.Replicas(),
+		ReadQuorum:       client.Quorum(c.Client.ReadQuorum),
+		WriteQuorum:      client.Quorum(c.Client.WriteQuorum),
+		Timeout:          c.Client.Timeout,
+		RecoveryInterval: c.Client.RecoveryInterval,
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadExample(t *testing.T) {
+	c, err := Load("../cluster.example.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"localhost:8080", "localhost:8081", "localhost:8082"}, c.Addresses())
+	assert.Equal(t, 3, c.Replicas())
+	assert.Equal(t, 2*time.Second, c.PendingTimeout)
+	assert.Equal(t, 8070, c.Client.Port)
+
+	cfg := c.ClientConfig()
+	assert.Equal(t, client.QuorumMajority, cfg.ReadQuorum)
+	assert.Equal(t, 3*time.Second, cfg.Timeout)
+	assert.Equal(t, 10*time.Second, cfg.RecoveryInterval)
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cluster.json")
+	err := os.WriteFile(path, []byte(`{
+		"nodes": [
+			{"id": 1, "address": "http://10.0.0.2:8080"},
+			{"id": 0, "address": "10.0.0.1:8080"},
+			{"id": 2, "address": "10.0.0.3:8080"}
+		],
+		"client": {"writeQuorum": "ALL", "timeout": "500ms"}
+	}`), 0644)
+	assert.Nil(t, err)
+
+	c, err := Load(path)
+	assert.Nil(t, err)
+	// Addresses are in order of node ID, not of the file
+	assert.Equal(t, []string{"10.0.0.1:8080", "http://10.0.0.2:8080", "10.0.0.3:8080"}, c.Addresses())
+	assert.Equal(t, 3, c.Replicas())
+	assert.Equal(t, client.QuorumAll, c.ClientConfig().WriteQuorum)
+	assert.Equal(t, 500*time.Millisecond, c.ClientConfig().Timeout)
+
+	// Misspelled fields are errors rather than silently ignored
+	err = os.WriteFile(path, []byte(`{"nodes": [{"id": 0, "address": "localhost:8080"}], "numReplica": 1}`), 0644)
+	assert.Nil(t, err)
+	_, err = Load(path)
+	assert.NotNil(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	addrs := []string{"localhost:8080", "localhost:8081", "localhost:8082"}
+
+	assert.Nil(t, FromAddresses(addrs, 0).Validate())
+	assert.Nil(t, FromAddresses(addrs, 2).Validate())
+
+	// Replicas outside [TotalNodes/2+1, TotalNodes]
+	assert.NotNil(t, FromAddresses(addrs, 1).Validate())
+	assert.NotNil(t, FromAddresses(addrs, 4).Validate())
+
+	assert.NotNil(t, FromAddresses(nil, 0).Validate())
+	assert.NotNil(t, FromAddresses(addrs[:2], 0).Validate())
+	assert.NotNil(t, FromAddresses([]string{"localhost:8080", "localhost:8080", "localhost:8082"}, 0).Validate())
+	assert.NotNil(t, FromAddresses([]string{"localhost:8080", "localhost", "localhost:8082"}, 0).Validate())
+
+	c := FromAddresses(addrs, 0)
+	c.Nodes[2].ID = 3
+	assert.NotNil(t, c.Validate())
+	c.Nodes[2].ID = 1
+	assert.NotNil(t, c.Validate())
+
+	c = FromAddresses(addrs, 2)
+	c.Client.ReadQuorum = "ALL"
+	assert.Nil(t, c.Validate())
+	c.Client.ReadQuorum = "3"
+	assert.NotNil(t, c.Validate())
+	c.Client.ReadQuorum = "MOST"
+	assert.NotNil(t, c.Validate())
+}
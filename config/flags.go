@@ -0,0 +1,44 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"strings"
+)
+
+// Flags are the command line flags that describe the cluster, shared by cmd/node and cmd/client
+type Flags struct {
+	path        *string
+	nodes       *string
+	numReplicas *int
+}
+
+// RegisterFlags adds -config, -nodes and -num-replicas to fs
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	return &Flags{
+		path:        fs.String("config", "", "YAML or JSON cluster configuration file"),
+		nodes:       fs.String("nodes", "", "comma separated addresses of every node in order of node ID, as host:port or URLs, instead of -config"),
+		numReplicas: fs.Int("num-replicas", 0, "how many nodes each address is replicated to when using -nodes; defaults to every node"),
+	}
+}
+
+// Cluster loads the cluster from -config, or builds it from -nodes and -num-replicas
+func (f *Flags) Cluster() (*Cluster, error) {
+	if *f.path != "" {
+		if *f.nodes != "" || *f.numReplicas != 0 {
+			return nil, errors.New("-nodes and -num-replicas can't be used with -config")
+		}
+		return Load(*f.path)
+	}
+
+	if *f.nodes == "" {
+		return nil, errors.New("Either -config or -nodes is required")
+	}
+
+	c := FromAddresses(strings.Split(*f.nodes, ","), *f.numReplicas)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
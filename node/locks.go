@@ -0,0 +1,72 @@
+package node
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// addrLocks hands out a mutex per address. An address's mutex is dropped once nothing holds
+// or waits on it, so the table only grows with the number of addresses in use at once, not
+// with every address the node has seen.
+type addrLocks struct {
+	seed   maphash.Seed
+	shards [numShards]lockShard
+}
+
+type lockShard struct {
+	mu    sync.Mutex
+	locks map[string]*addrLock
+}
+
+type addrLock struct {
+	mu sync.Mutex
+	// refs counts the callers holding or waiting on mu, guarded by the shard's mutex
+	refs int
+}
+
+func newAddrLocks() *addrLocks {
+	l := &addrLocks{seed: maphash.MakeSeed()}
+	for i := range l.shards {
+		l.shards[i].locks = make(map[string]*addrLock)
+	}
+	return l
+}
+
+// lock locks addr, and returns the function that unlocks it
+func (l *addrLocks) lock(addr string) func() {
+	s := &l.shards[maphash.String(l.seed, addr)%numShards]
+
+	s.mu.Lock()
+	al, ok := s.locks[addr]
+	if !ok {
+		al = &addrLock{}
+		s.locks[addr] = al
+	}
+	al.refs++
+	s.mu.Unlock()
+
+	al.mu.Lock()
+
+	return func() {
+		al.mu.Unlock()
+
+		s.mu.Lock()
+		al.refs--
+		if al.refs == 0 {
+			delete(s.locks, addr)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// len returns how many addresses currently have a mutex
+func (l *addrLocks) len() int {
+	n := 0
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.mu.Lock()
+		n += len(s.locks)
+		s.mu.Unlock()
+	}
+	return n
+}
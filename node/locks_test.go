@@ -0,0 +1,86 @@
+package node
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddrLocks(t *testing.T) {
+	l := newAddrLocks()
+
+	// Holders of the same address exclude each other
+	counts := make([]int, 4)
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				unlock := l.lock("addr" + strconv.Itoa(i%4))
+				counts[i%4]++
+				unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, []int{4000, 4000, 4000, 4000}, counts)
+
+	// Released addresses are forgotten
+	assert.Equal(t, 0, l.len())
+
+	unlock := l.lock("held")
+	for i := 0; i < 10000; i++ {
+		l.lock("addr" + strconv.Itoa(i))()
+	}
+	assert.Equal(t, 1, l.len())
+	unlock()
+	assert.Equal(t, 0, l.len())
+}
+
+// BenchmarkLockDistinctAddresses locks b.N distinct addresses, and reports how much the heap
+// and the lock table grew. Both stay flat no matter how many addresses are locked, e.g. with
+// -benchtime=5000000x.
+func BenchmarkLockDistinctAddresses(b *testing.B) {
+	l := newAddrLocks()
+	before := heapAlloc()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.lock("addr" + strconv.Itoa(i))()
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(heapAlloc()-before), "heap-bytes")
+	b.ReportMetric(float64(l.len()), "locks")
+}
+
+// BenchmarkSyncMapDistinctAddresses is the mutex-per-address sync.Map that addrLocks replaced,
+// for comparison: its heap grows with every address.
+func BenchmarkSyncMapDistinctAddresses(b *testing.B) {
+	var mutexes sync.Map
+	before := heapAlloc()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		loadMtx, _ := mutexes.LoadOrStore("addr"+strconv.Itoa(i), &sync.Mutex{})
+		mtx := loadMtx.(*sync.Mutex)
+		mtx.Lock()
+		mtx.Unlock()
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(heapAlloc()-before), "heap-bytes")
+	runtime.KeepAlive(&mutexes)
+}
+
+func heapAlloc() int64 {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return int64(ms.HeapAlloc)
+}
@@ -1,8 +1,7 @@
 package node
 
 import (
-	"errors"
-	"fmt"
+	"context"
 	"log"
 	"net/http"
 	"sync"
@@ -11,7 +10,8 @@ import (
 	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
 )
 
-const pendingTimeout = 2 * time.Second
+// DefaultPendingTimeout is how long a pending value blocks other writes by default
+const DefaultPendingTimeout = 2 * time.Second
 
 type Node struct {
 	Server     *http.Server
@@ -21,17 +21,28 @@ type Node struct {
 	// NumReplicas / TotalNodes defines the fraction of nodes values should be replicated to
 	// (TotalNodes/2+1) <= NumReplicas <= TotalNodes
 	NumReplicas int
+	// PendingTimeout is how long a pending value blocks other writes before it can be replaced
+	PendingTimeout time.Duration
 
-	Memory  map[string]AddressData
-	mutexes sync.Map
+	Storage Storage
+	locks   *addrLocks
+	// clock timestamps the writes the node confirms without a commit timestamp, and is exchanged
+	// with clients on every request
+	clock *shared.Clock
 
-	Flags TestingFlags
+	snapshotStop chan struct{}
+
+	// Flags can be set directly until the node starts serving. After that, use SetRefuseFlags.
+	Flags   TestingFlags
+	flagsMu sync.RWMutex
 }
 
 type TestingFlags struct {
 	RefuseRead    bool
 	RefuseWrite   bool
 	RefuseConfirm bool
+	RefuseAbort   bool
+	RefuseUpdate  bool
 	Time          *time.Time
 }
 
@@ -41,34 +52,89 @@ type AddressData struct {
 
 	PendingValue     *string
 	PendingTimestamp *time.Time
+	// PendingWriteID identifies the write that pre-committed PendingValue
+	PendingWriteID string
+}
+
+// State returns what a node reports about addr
+func (ad AddressData) State(addr string, shouldInclude bool) shared.NodeStateRes {
+	return shared.NodeStateRes{
+		ValueVersion:  ad.ValueVersion,
+		Pending:       ad.Pending(addr),
+		ShouldInclude: shouldInclude,
+	}
+}
+
+// Pending returns the pending write at addr, or nil if there isn't one
+func (ad AddressData) Pending(addr string) *shared.PendingWrite {
+	if ad.PendingValue == nil {
+		return nil
+	}
+
+	return &shared.PendingWrite{
+		Address:   addr,
+		Value:     *ad.PendingValue,
+		WriteID:   ad.PendingWriteID,
+		Timestamp: *ad.PendingTimestamp,
+	}
 }
 
 func New(id, port, totalNodes, numReplicas int) *Node {
+	return NewWithStorage(id, port, totalNodes, numReplicas, NewMemoryStorage())
+}
+
+// NewWithStorage creates a node that keeps its memory in storage
+func NewWithStorage(id, port, totalNodes, numReplicas int, storage Storage) *Node {
 	return &Node{
 		ID:          id,
 		Port:        port,
 		TotalNodes:  totalNodes,
 		NumReplicas: numReplicas,
 
-		Memory: make(map[string]AddressData),
+		PendingTimeout: DefaultPendingTimeout,
+
+		Storage: storage,
+		locks:   newAddrLocks(),
+		clock:   shared.NewClock(),
 
 		Flags: TestingFlags{},
 	}
 }
 
+// Close stops periodic snapshots and releases the node's storage
+func (n *Node) Close() error {
+	if n.snapshotStop != nil {
+		close(n.snapshotStop)
+		n.snapshotStop = nil
+	}
+	return n.Storage.Close()
+}
+
+// flags returns a copy of the node's testing flags
+func (n *Node) flags() TestingFlags {
+	n.flagsMu.RLock()
+	defer n.flagsMu.RUnlock()
+
+	return n.Flags
+}
+
 func (n *Node) GetNow() time.Time {
-	if n.Flags.Time != nil {
-		return *n.Flags.Time
+	if t := n.flags().Time; t != nil {
+		return *t
 	}
 	return time.Now().UTC()
 }
 
 // Read returns the value at the given address
-func (n *Node) Read(addr string) (shared.ValueVersion, bool, error) {
+func (n *Node) Read(ctx context.Context, addr string) (shared.ValueVersion, bool, error) {
 	log.Printf("Node %d reading address %s", n.ID, addr)
 
-	if n.Flags.RefuseRead {
-		return shared.ValueVersion{}, false, errors.New("Refusing to read because of testing flag")
+	if err := ctx.Err(); err != nil {
+		return shared.ValueVersion{}, false, err
+	}
+
+	if n.flags().RefuseRead {
+		return shared.ValueVersion{}, false, shared.Unavailable("Refusing to read because of testing flag")
 	}
 
 	shouldInclude := shared.HashAndCheckShardInclusion(addr, n.ID, n.TotalNodes, n.NumReplicas)
@@ -76,21 +142,125 @@ func (n *Node) Read(addr string) (shared.ValueVersion, bool, error) {
 		return shared.ValueVersion{}, false, nil
 	}
 
-	ad, ok := n.Memory[addr]
+	ad, ok := n.Storage.Get(addr)
 	if !ok || ad.ValueVersion.Version == 0 {
-		return shared.ValueVersion{}, true, errors.New(fmt.Sprintf("Address %s not found", addr))
+		return shared.ValueVersion{}, true, shared.NotFound("Address %s not found", addr)
 	}
 
 	log.Printf("Node %d returned address %s with value %s and version %d", n.ID, addr, ad.ValueVersion.Value, ad.ValueVersion.Version)
 	return ad.ValueVersion, true, nil
 }
 
-// Write "pre-commits" the specified value at the given address
-func (n *Node) Write(addr string, val string) (bool, error) {
-	log.Printf("Node %d writing to address %s with value %s", n.ID, addr, val)
+// State returns everything stored at the given address, including any pending value.
+// Unlike Read, it doesn't fail if the address has never been confirmed.
+func (n *Node) State(addr string) (AddressData, bool, error) {
+	if n.flags().RefuseRead {
+		return AddressData{}, false, shared.Unavailable("Refusing to read because of testing flag")
+	}
 
-	if n.Flags.RefuseWrite {
-		return false, errors.New("Refusing to write because of testing flag")
+	shouldInclude := shared.HashAndCheckShardInclusion(addr, n.ID, n.TotalNodes, n.NumReplicas)
+	if !shouldInclude {
+		return AddressData{}, false, nil
+	}
+
+	ad, _ := n.Storage.Get(addr)
+	return ad, true, nil
+}
+
+// StalePending returns every pending write that has outlived the pending timeout.
+// These are usually left behind by clients that crashed between writing and confirming.
+func (n *Node) StalePending() []shared.PendingWrite {
+	now := n.GetNow()
+
+	var stale []shared.PendingWrite
+	n.Storage.Iterate(func(addr string, ad AddressData) {
+		if ad.PendingValue != nil && ad.PendingTimestamp.Add(n.PendingTimeout).Before(now) {
+			stale = append(stale, *ad.Pending(addr))
+		}
+	})
+
+	return stale
+}
+
+// Status summarizes the node's configuration and what it stores
+func (n *Node) Status() shared.NodeStatusRes {
+	res := shared.NodeStatusRes{
+		ID:          n.ID,
+		TotalNodes:  n.TotalNodes,
+		NumReplicas: n.NumReplicas,
+	}
+
+	n.Storage.Iterate(func(addr string, ad AddressData) {
+		res.Addresses++
+		if ad.PendingValue != nil {
+			res.Pending++
+		}
+	})
+
+	return res
+}
+
+// RefuseFlags returns the node's testing flags that can be toggled over HTTP
+func (n *Node) RefuseFlags() shared.NodeFlags {
+	flags := n.flags()
+	return shared.NodeFlags{
+		RefuseRead:    flags.RefuseRead,
+		RefuseWrite:   flags.RefuseWrite,
+		RefuseConfirm: flags.RefuseConfirm,
+		RefuseAbort:   flags.RefuseAbort,
+		RefuseUpdate:  flags.RefuseUpdate,
+	}
+}
+
+// SetRefuseFlags replaces the node's refuse flags, leaving its testing time alone
+func (n *Node) SetRefuseFlags(f shared.NodeFlags) {
+	log.Printf("Node %d setting testing flags %+v", n.ID, f)
+
+	n.flagsMu.Lock()
+	defer n.flagsMu.Unlock()
+
+	n.Flags.RefuseRead = f.RefuseRead
+	n.Flags.RefuseWrite = f.RefuseWrite
+	n.Flags.RefuseConfirm = f.RefuseConfirm
+	n.Flags.RefuseAbort = f.RefuseAbort
+	n.Flags.RefuseUpdate = f.RefuseUpdate
+}
+
+// Dump returns the state of every address stored on the node
+func (n *Node) Dump() (map[string]shared.NodeStateRes, error) {
+	if n.flags().RefuseRead {
+		return nil, shared.Unavailable("Refusing to read because of testing flag")
+	}
+
+	states := make(map[string]shared.NodeStateRes)
+	n.Storage.Iterate(func(addr string, ad AddressData) {
+		states[addr] = ad.State(addr, true)
+	})
+
+	return states, nil
+}
+
+// Write "pre-commits" the specified value at the given address on behalf of writeID
+func (n *Node) Write(ctx context.Context, addr string, val string, writeID string) (bool, error) {
+	return n.write(ctx, addr, val, writeID, nil)
+}
+
+// CompareAndWrite "pre-commits" the specified value at the given address, as long as the
+// address's confirmed version is expectedVersion. An address that has never been confirmed
+// is at version 0.
+func (n *Node) CompareAndWrite(ctx context.Context, addr string, val string, writeID string, expectedVersion int) (bool, error) {
+	return n.write(ctx, addr, val, writeID, &expectedVersion)
+}
+
+func (n *Node) write(ctx context.Context, addr string, val string, writeID string, expectedVersion *int) (bool, error) {
+	log.Printf("Node %d writing to address %s with value %s for write %s", n.ID, addr, val, writeID)
+
+	if n.flags().RefuseWrite {
+		return false, shared.Unavailable("Refusing to write because of testing flag")
+	}
+
+	if writeID == "" {
+		return false, shared.BadRequest("Write ID is required")
 	}
 
 	shouldInclude := shared.HashAndCheckShardInclusion(addr, n.ID, n.TotalNodes, n.NumReplicas)
@@ -98,21 +268,37 @@ func (n *Node) Write(addr string, val string) (bool, error) {
 		return false, nil
 	}
 
-	loadMtx, _ := n.mutexes.LoadOrStore(addr, &sync.Mutex{})
-	mtx := loadMtx.(*sync.Mutex)
-	mtx.Lock()
+	unlock := n.locks.lock(addr)
+	defer unlock()
+
+	// The request may have been abandoned while it waited for the address
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
 
-	defer mtx.Unlock()
+	ad, ok := n.Storage.Get(addr)
 
-	ad, ok := n.Memory[addr]
+	// The version is checked under the address's mutex, so nothing can be confirmed in between
+	if expectedVersion != nil && ad.ValueVersion.Version != *expectedVersion {
+		log.Printf("Node %d rejected precommitment to address %s at version %d, expected version %d", n.ID, addr, ad.ValueVersion.Version, *expectedVersion)
+		return true, &shared.ConflictError{
+			Address:         addr,
+			ExpectedVersion: *expectedVersion,
+			ObservedVersion: ad.ValueVersion.Version,
+		}
+	}
 
 	now := n.GetNow()
 	// Current address has never been seen before
 	if !ok {
-		n.Memory[addr] = AddressData{
+		err := n.Storage.PutPending(addr, AddressData{
 			ValueVersion:     shared.ValueVersion{},
 			PendingValue:     &val,
 			PendingTimestamp: &now,
+			PendingWriteID:   writeID,
+		})
+		if err != nil {
+			return true, err
 		}
 		log.Printf("Node %d precommited to address %s with value %s", n.ID, addr, val)
 		return true, nil
@@ -121,22 +307,36 @@ func (n *Node) Write(addr string, val string) (bool, error) {
 	// Current address has been seen before
 	// No pending values for the current address
 	if ad.PendingValue == nil {
-		n.Memory[addr] = AddressData{
+		err := n.Storage.PutPending(addr, AddressData{
 			ValueVersion:     ad.ValueVersion,
 			PendingValue:     &val,
 			PendingTimestamp: &now,
+			PendingWriteID:   writeID,
+		})
+		if err != nil {
+			return true, err
 		}
 		log.Printf("Node %d precommited to address %s with value %s", n.ID, addr, val)
 	} else {
 		// There is already a pending value for the current address
+		if ad.PendingWriteID == writeID {
+			// The same write retried its pre-commit
+			log.Printf("Node %d already precommited to address %s for write %s", n.ID, addr, writeID)
+			return true, nil
+		}
+
 		pt := *ad.PendingTimestamp
 		pv := *ad.PendingValue
 		// timeout expired, replace!
-		if pt.Add(pendingTimeout).Before(now) {
-			n.Memory[addr] = AddressData{
+		if pt.Add(n.PendingTimeout).Before(now) {
+			err := n.Storage.PutPending(addr, AddressData{
 				ValueVersion:     ad.ValueVersion,
 				PendingValue:     &val,
 				PendingTimestamp: &now,
+				PendingWriteID:   writeID,
+			})
+			if err != nil {
+				return true, err
 			}
 
 			log.Printf("Node %d precommited to address %s with value %s. Invalidated prev value %v", n.ID, addr, val, pv)
@@ -144,44 +344,76 @@ func (n *Node) Write(addr string, val string) (bool, error) {
 			log.Printf("Node %d rejected precommitment to address %s with value %s at time %v. Pending value %v at time %v", n.ID, addr, val, now, pv, pt)
 
 			// timeout didn't expire, reject
-			return true, errors.New(fmt.Sprintf("Address %s has a pending value %s", addr, *ad.PendingValue))
+			return true, shared.Conflict("Address %s has a pending value %s", addr, *ad.PendingValue)
 		}
 	}
 
 	return true, nil
 }
 
-// Confirm confirms the pending value at the given address
-func (n *Node) Confirm(addr string) error {
-	log.Printf("Node %d confirming address %s", n.ID, addr)
+// Confirm confirms the pending value at the given address, as long as it was pre-committed by writeID.
+// Confirming a write that has already been confirmed is a no-op. The value is timestamped with the
+// node's own clock, so replicas confirmed this way don't agree on it: Confirm is for a node on its
+// own, such as in tests. Writers confirm with ConfirmAt.
+func (n *Node) Confirm(ctx context.Context, addr string, writeID string) error {
+	return n.ConfirmAt(ctx, addr, writeID, n.clock.Now())
+}
+
+// ConfirmAt is Confirm for a write its writer committed at ts, which every replica stores with the value
+func (n *Node) ConfirmAt(ctx context.Context, addr string, writeID string, ts shared.Timestamp) error {
+	log.Printf("Node %d confirming address %s for write %s at %s", n.ID, addr, writeID, ts)
+	n.clock.Update(ts)
+
+	if n.flags().RefuseConfirm {
+		return shared.Unavailable("Refusing to confirm because of testing flag")
+	}
 
-	if n.Flags.RefuseConfirm {
-		return errors.New("Refusing to confirm because of testing flag")
+	if writeID == "" {
+		return shared.BadRequest("Write ID is required")
+	}
+	// Replicas only store the same timestamp if the writer picks it
+	if ts.IsZero() {
+		return shared.BadRequest("Commit timestamp is required")
 	}
 
-	loadMtx, _ := n.mutexes.LoadOrStore(addr, &sync.Mutex{})
-	mtx := loadMtx.(*sync.Mutex)
-	mtx.Lock()
+	unlock := n.locks.lock(addr)
+	defer unlock()
 
-	defer mtx.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	ad, ok := n.Memory[addr]
+	ad, ok := n.Storage.Get(addr)
 	if !ok {
-		return errors.New(fmt.Sprintf("Address %s not found", addr))
+		return shared.NotFound("Address %s not found", addr)
+	}
+
+	if ad.ValueVersion.WriteID == writeID {
+		log.Printf("Node %d already confirmed address %s for write %s", n.ID, addr, writeID)
+		return nil
 	}
 
 	if ad.PendingValue == nil {
-		return errors.New(fmt.Sprintf("Address %s has no pending value", addr))
+		return shared.Conflict("Address %s has no pending value", addr)
+	}
+
+	if ad.PendingWriteID != writeID {
+		return shared.Conflict("Address %s has a pending value from write %s, not write %s", addr, ad.PendingWriteID, writeID)
 	}
 
 	version := ad.ValueVersion.Version + 1
-	n.Memory[addr] = AddressData{
+	err := n.Storage.Confirm(addr, AddressData{
 		ValueVersion: shared.ValueVersion{
-			Value:   *ad.PendingValue,
-			Version: version,
+			Value:     *ad.PendingValue,
+			Version:   version,
+			WriteID:   writeID,
+			Timestamp: ts,
 		},
 		PendingValue:     nil,
 		PendingTimestamp: nil,
+	})
+	if err != nil {
+		return err
 	}
 
 	log.Printf("Node %d confirmed address %s with value %s and version %d", n.ID, addr, *ad.PendingValue, version)
@@ -189,36 +421,82 @@ func (n *Node) Confirm(addr string) error {
 	return nil
 }
 
-// Update forcibly updates the current value and version at an address.
-func (n *Node) Update(addr, val string, version int) error {
-	log.Printf("Node %d updating address %s with val %s and version %d", n.ID, addr, val, version)
+// Abort clears the pending value at the given address, as long as it was pre-committed by writeID.
+// It is a no-op if the pending value has already been confirmed, or replaced by another write.
+func (n *Node) Abort(ctx context.Context, addr, writeID string) error {
+	log.Printf("Node %d aborting address %s for write %s", n.ID, addr, writeID)
+
+	if n.flags().RefuseAbort {
+		return shared.Unavailable("Refusing to abort because of testing flag")
+	}
 
-	loadMtx, _ := n.mutexes.LoadOrStore(addr, &sync.Mutex{})
-	mtx := loadMtx.(*sync.Mutex)
-	mtx.Lock()
+	if writeID == "" {
+		return shared.BadRequest("Write ID is required")
+	}
 
-	defer mtx.Unlock()
+	unlock := n.locks.lock(addr)
+	defer unlock()
 
-	updatedVV := shared.ValueVersion{
-		Value:   val,
-		Version: version,
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	ad, ok := n.Memory[addr]
-	if !ok {
-		n.Memory[addr] = AddressData{
-			ValueVersion: updatedVV,
-		}
+	ad, ok := n.Storage.Get(addr)
+	if !ok || ad.PendingValue == nil || ad.PendingWriteID != writeID {
+		log.Printf("Node %d has no pending value to abort at address %s for write %s", n.ID, addr, writeID)
 		return nil
 	}
 
-	n.Memory[addr] = AddressData{
-		ValueVersion:     updatedVV,
-		PendingValue:     ad.PendingValue,
-		PendingTimestamp: ad.PendingTimestamp,
+	err := n.Storage.Abort(addr, AddressData{
+		ValueVersion:     ad.ValueVersion,
+		PendingValue:     nil,
+		PendingTimestamp: nil,
+	})
+	if err != nil {
+		return err
 	}
 
-	log.Printf("Node %d updated address %s with val %s and version %d", n.ID, addr, val, version)
+	log.Printf("Node %d aborted address %s with value %s for write %s", n.ID, addr, *ad.PendingValue, writeID)
 
 	return nil
 }
+
+// Update replaces the value at an address with vv, as long as vv is newer than the address's
+// confirmed value, and returns whether it did. A pending value was pre-committed against the
+// value being replaced, so an applied update clears it.
+func (n *Node) Update(ctx context.Context, addr string, vv shared.ValueVersion) (bool, error) {
+	log.Printf("Node %d updating address %s with val %s and version %d from write %s", n.ID, addr, vv.Value, vv.Version, vv.WriteID)
+	n.clock.Update(vv.Timestamp)
+
+	if n.flags().RefuseUpdate {
+		return false, shared.Unavailable("Refusing to update because of testing flag")
+	}
+
+	unlock := n.locks.lock(addr)
+	defer unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	ad, ok := n.Storage.Get(addr)
+	if ok && !vv.Newer(ad.ValueVersion) {
+		log.Printf("Node %d ignored update to address %s with version %d from write %s, already at version %d from write %s", n.ID, addr, vv.Version, vv.WriteID, ad.ValueVersion.Version, ad.ValueVersion.WriteID)
+		return false, nil
+	}
+
+	err := n.Storage.Update(addr, AddressData{
+		ValueVersion: vv,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if ad.PendingValue != nil {
+		log.Printf("Node %d updated address %s with val %s and version %d, superseding pending value %s for write %s", n.ID, addr, vv.Value, vv.Version, *ad.PendingValue, ad.PendingWriteID)
+	} else {
+		log.Printf("Node %d updated address %s with val %s and version %d", n.ID, addr, vv.Value, vv.Version)
+	}
+
+	return true, nil
+}
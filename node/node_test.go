@@ -1,35 +1,43 @@
 package node
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestInitialization(t *testing.T) {
 	n := New(0, 8080, 1, 1)
 
-	_, shouldInclude, err := n.Read("addr1")
+	_, shouldInclude, err := n.Read(context.Background(), "addr1")
 	assert.NotNil(t, err)
 	assert.True(t, shouldInclude)
 
-	_, err = n.Write("addr1", "val1")
+	_, err = n.Write(context.Background(), "addr1", "val1", "w1")
 	assert.Nil(t, err)
-	_, _, err = n.Read("addr1")
+	_, _, err = n.Read(context.Background(), "addr1")
 	assert.NotNil(t, err)
 }
 
 func TestWriteAndConfirm(t *testing.T) {
 	n := New(0, 8080, 1, 1)
 
-	_, err := n.Write("addr1", "val1")
+	_, err := n.Write(context.Background(), "addr1", "val1", "w1")
 	assert.Nil(t, err)
 
-	err = n.Confirm("addr1")
+	err = n.Confirm(context.Background(), "addr1", "w1")
 	assert.Nil(t, err)
 
-	vv, _, err := n.Read("addr1")
+	vv, _, err := n.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, vv.Value, "val1")
 	assert.Equal(t, vv.Version, 1)
@@ -38,17 +46,17 @@ func TestWriteAndConfirm(t *testing.T) {
 func TestWriteNoTimeout(t *testing.T) {
 	n := New(0, 8080, 1, 1)
 
-	shouldInclude, err := n.Write("addr1", "val1")
+	shouldInclude, err := n.Write(context.Background(), "addr1", "val1", "w1")
 	assert.Nil(t, err)
 	assert.True(t, shouldInclude)
 
-	_, err = n.Write("addr1", "val2")
+	_, err = n.Write(context.Background(), "addr1", "val2", "w2")
 	assert.NotNil(t, err)
 
-	err = n.Confirm("addr1")
+	err = n.Confirm(context.Background(), "addr1", "w1")
 	assert.Nil(t, err)
 
-	vv, _, err := n.Read("addr1")
+	vv, _, err := n.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, vv.Value, "val1")
 	assert.Equal(t, vv.Version, 1)
@@ -57,19 +65,332 @@ func TestWriteNoTimeout(t *testing.T) {
 func TestWriteWithTimeout(t *testing.T) {
 	n := New(0, 8080, 1, 1)
 
-	_, err := n.Write("addr1", "val1")
+	_, err := n.Write(context.Background(), "addr1", "val1", "w1")
 	assert.Nil(t, err)
 
-	time.Sleep(pendingTimeout + 1*time.Second)
+	time.Sleep(DefaultPendingTimeout + 1*time.Second)
 
-	_, err = n.Write("addr1", "val2")
+	_, err = n.Write(context.Background(), "addr1", "val2", "w2")
 	assert.Nil(t, err)
 
-	err = n.Confirm("addr1")
+	err = n.Confirm(context.Background(), "addr1", "w2")
 	assert.Nil(t, err)
 
-	vv, _, err := n.Read("addr1")
+	vv, _, err := n.Read(context.Background(), "addr1")
 	assert.Nil(t, err)
 	assert.Equal(t, vv.Value, "val2")
 	assert.Equal(t, vv.Version, 1)
 }
+
+func TestCompareAndWrite(t *testing.T) {
+	n := New(0, 8080, 1, 1)
+
+	// Addresses that have never been confirmed are at version 0
+	_, err := n.CompareAndWrite(context.Background(), "addr1", "val1", "w1", 1)
+	assert.NotNil(t, err)
+
+	_, err = n.CompareAndWrite(context.Background(), "addr1", "val1", "w1", 0)
+	assert.Nil(t, err)
+	err = n.Confirm(context.Background(), "addr1", "w1")
+	assert.Nil(t, err)
+
+	_, err = n.CompareAndWrite(context.Background(), "addr1", "val2", "w2", 0)
+	var conflict *shared.ConflictError
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, 0, conflict.ExpectedVersion)
+	assert.Equal(t, 1, conflict.ObservedVersion)
+
+	_, err = n.CompareAndWrite(context.Background(), "addr1", "val2", "w2", 1)
+	assert.Nil(t, err)
+	err = n.Confirm(context.Background(), "addr1", "w2")
+	assert.Nil(t, err)
+
+	vv, _, err := n.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", vv.Value)
+	assert.Equal(t, 2, vv.Version)
+}
+
+func TestAbort(t *testing.T) {
+	n := New(0, 8080, 1, 1)
+
+	_, err := n.Write(context.Background(), "addr1", "val1", "w1")
+	assert.Nil(t, err)
+
+	// Aborting someone else's value leaves the pending value alone
+	err = n.Abort(context.Background(), "addr1", "w2")
+	assert.Nil(t, err)
+	_, err = n.Write(context.Background(), "addr1", "val2", "w2")
+	assert.NotNil(t, err)
+
+	err = n.Abort(context.Background(), "addr1", "w1")
+	assert.Nil(t, err)
+	err = n.Confirm(context.Background(), "addr1", "w1")
+	assert.NotNil(t, err)
+
+	// Nothing is pending anymore, so other writes can go through
+	_, err = n.Write(context.Background(), "addr1", "val2", "w2")
+	assert.Nil(t, err)
+	err = n.Confirm(context.Background(), "addr1", "w2")
+	assert.Nil(t, err)
+
+	vv, _, err := n.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", vv.Value)
+	assert.Equal(t, 1, vv.Version)
+}
+
+// Test that a late confirm doesn't commit a value pre-committed by a different write
+func TestConfirmWriteID(t *testing.T) {
+	n := New(0, 8080, 1, 1)
+
+	_, err := n.Write(context.Background(), "addr1", "val1", "w1")
+	assert.Nil(t, err)
+
+	// w1's pre-commit times out and is replaced by w2
+	forwardTime := time.Now().UTC().Add(DefaultPendingTimeout + time.Second)
+	n.Flags.Time = &forwardTime
+	_, err = n.Write(context.Background(), "addr1", "val2", "w2")
+	assert.Nil(t, err)
+
+	err = n.Confirm(context.Background(), "addr1", "w1")
+	assert.NotNil(t, err)
+
+	err = n.Confirm(context.Background(), "addr1", "w2")
+	assert.Nil(t, err)
+	// Confirming the same write again is a no-op
+	err = n.Confirm(context.Background(), "addr1", "w2")
+	assert.Nil(t, err)
+
+	vv, _, err := n.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", vv.Value)
+	assert.Equal(t, 1, vv.Version)
+
+	// Still a no-op once another write is pending
+	_, err = n.Write(context.Background(), "addr1", "val3", "w3")
+	assert.Nil(t, err)
+	err = n.Confirm(context.Background(), "addr1", "w2")
+	assert.Nil(t, err)
+	vv, _, err = n.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", vv.Value)
+	assert.Equal(t, 1, vv.Version)
+
+	err = n.Confirm(context.Background(), "addr1", "w3")
+	assert.Nil(t, err)
+	vv, _, err = n.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val3", vv.Value)
+	assert.Equal(t, 2, vv.Version)
+}
+
+func TestCancelledRequest(t *testing.T) {
+	n := New(0, 8080, 1, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A request abandoned by its client isn't applied
+	_, err := n.Write(ctx, "addr1", "val1", "w1")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, ok := n.Storage.Get("addr1")
+	assert.False(t, ok)
+
+	_, err = n.Write(context.Background(), "addr1", "val1", "w1")
+	assert.Nil(t, err)
+	err = n.Confirm(ctx, "addr1", "w1")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = n.Confirm(context.Background(), "addr1", "w1")
+	assert.Nil(t, err)
+	_, err = n.Update(ctx, "addr1", shared.ValueVersion{Value: "val2", Version: 2, WriteID: "w2"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	vv, _, err := n.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", vv.Value)
+	assert.Equal(t, 1, vv.Version)
+}
+
+func TestUpdateVersionGuard(t *testing.T) {
+	n := New(0, 8080, 1, 1)
+	ctx := context.Background()
+
+	_, err := n.Write(ctx, "addr1", "val1", "w1")
+	assert.Nil(t, err)
+	assert.Nil(t, n.Confirm(ctx, "addr1", "w1"))
+
+	// A repair that isn't newer leaves the address and its pending value alone
+	_, err = n.Write(ctx, "addr1", "val2", "w2")
+	assert.Nil(t, err)
+	applied, err := n.Update(ctx, "addr1", shared.ValueVersion{Value: "val1", Version: 1, WriteID: "w1"})
+	assert.Nil(t, err)
+	assert.False(t, applied)
+
+	// A slow repair that arrives after a confirm doesn't move the address backwards
+	ts := shared.Timestamp{WallTime: time.Now().UnixNano()}
+	assert.Nil(t, n.ConfirmAt(ctx, "addr1", "w2", ts))
+	applied, err = n.Update(ctx, "addr1", shared.ValueVersion{Value: "val1", Version: 1, WriteID: "w1"})
+	assert.Nil(t, err)
+	assert.False(t, applied)
+	vv, _, err := n.Read(ctx, "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, shared.ValueVersion{Value: "val2", Version: 2, WriteID: "w2", Timestamp: ts}, vv)
+
+	// A newer repair supersedes the pending value, so its confirm no longer applies
+	_, err = n.Write(ctx, "addr1", "val3", "w3")
+	assert.Nil(t, err)
+	applied, err = n.Update(ctx, "addr1", shared.ValueVersion{Value: "val4", Version: 4, WriteID: "w4"})
+	assert.Nil(t, err)
+	assert.True(t, applied)
+	assert.ErrorIs(t, n.Confirm(ctx, "addr1", "w3"), shared.ErrConflict)
+	ad, _, err := n.State("addr1")
+	assert.Nil(t, err)
+	assert.Nil(t, ad.PendingValue)
+	assert.Equal(t, shared.ValueVersion{Value: "val4", Version: 4, WriteID: "w4"}, ad.ValueVersion)
+
+	// The resolver reports whether the update applied, and the version the node holds
+	w := httptest.NewRecorder()
+	n.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/update", strings.NewReader(`{"address": "addr1", "value": "val3", "version": 3}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var res shared.NodeUpdateRes
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Equal(t, shared.NodeUpdateRes{Applied: false, Version: 4}, res)
+
+	// Writes that confirmed the same version are ordered by write ID
+	applied, err = n.Update(ctx, "addr1", shared.ValueVersion{Value: "val5", Version: 4, WriteID: "w5"})
+	assert.Nil(t, err)
+	assert.True(t, applied)
+	applied, err = n.Update(ctx, "addr1", shared.ValueVersion{Value: "val4", Version: 4, WriteID: "w4"})
+	assert.Nil(t, err)
+	assert.False(t, applied)
+	vv, _, err = n.Read(ctx, "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, shared.ValueVersion{Value: "val5", Version: 4, WriteID: "w5"}, vv)
+}
+
+func TestUpdateInterleavedWithConfirms(t *testing.T) {
+	n := New(0, 8080, 1, 1)
+	ctx := context.Background()
+	const numWrites = 200
+
+	// Every value the address has had, in order. All but the last have been overwritten.
+	var mu sync.Mutex
+	var history []shared.ValueVersion
+
+	done := make(chan struct{})
+	var repairs sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		repairs.Add(1)
+		go func(r int) {
+			defer repairs.Done()
+			for i := r; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				// Repairs carry a value read before confirms moved the address past it
+				mu.Lock()
+				if len(history) < 2 {
+					mu.Unlock()
+					continue
+				}
+				stale := history[i%(len(history)-1)]
+				mu.Unlock()
+
+				applied, err := n.Update(ctx, "addr1", stale)
+				assert.Nil(t, err)
+				assert.False(t, applied)
+			}
+		}(r)
+	}
+
+	for i := 0; i < numWrites; i++ {
+		writeID := fmt.Sprintf("w%d", i)
+		_, err := n.Write(ctx, "addr1", writeID, writeID)
+		assert.Nil(t, err)
+		// Stale repairs don't clear the pending value, so the confirm applies
+		assert.Nil(t, n.Confirm(ctx, "addr1", writeID))
+
+		vv, _, err := n.Read(ctx, "addr1")
+		assert.Nil(t, err)
+		assert.Equal(t, writeID, vv.Value)
+		assert.Equal(t, i+1, vv.Version)
+
+		mu.Lock()
+		history = append(history, vv)
+		mu.Unlock()
+	}
+
+	close(done)
+	repairs.Wait()
+
+	// Replaying every older value afterwards leaves the latest one in place
+	latest := history[numWrites-1]
+	for _, stale := range history[:numWrites-1] {
+		applied, err := n.Update(ctx, "addr1", stale)
+		assert.Nil(t, err)
+		assert.False(t, applied)
+	}
+
+	vv, _, err := n.Read(ctx, "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, latest, vv)
+	assert.Equal(t, fmt.Sprintf("w%d", numWrites-1), vv.Value)
+	assert.Equal(t, numWrites, vv.Version)
+}
+
+func TestStatusAndDump(t *testing.T) {
+	n := New(1, 8081, 3, 2)
+
+	_, err := n.Write(context.Background(), "addr1", "val1", "w1")
+	assert.Nil(t, err)
+	err = n.Confirm(context.Background(), "addr1", "w1")
+	assert.Nil(t, err)
+	_, err = n.Write(context.Background(), "addr2", "val2", "w2")
+	assert.Nil(t, err)
+
+	status := n.Status()
+	assert.Equal(t, 1, status.ID)
+	assert.Equal(t, 3, status.TotalNodes)
+	assert.Equal(t, 2, status.NumReplicas)
+	assert.Equal(t, 2, status.Addresses)
+	assert.Equal(t, 1, status.Pending)
+
+	states, err := n.Dump()
+	assert.Nil(t, err)
+	assert.Len(t, states, 2)
+	assert.Equal(t, "val1", states["addr1"].ValueVersion.Value)
+	assert.Equal(t, 1, states["addr1"].ValueVersion.Version)
+	assert.Nil(t, states["addr1"].Pending)
+	assert.NotNil(t, states["addr2"].Pending)
+
+	n.Flags.RefuseRead = true
+	_, err = n.Dump()
+	assert.NotNil(t, err)
+}
+
+func TestErrorStatusCodes(t *testing.T) {
+	n := New(0, 8080, 1, 1)
+
+	serve := func(method, path, body string) int {
+		w := httptest.NewRecorder()
+		n.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/read?address=addr1", ""))
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/write", "{"))
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/write", `{"address": "addr1", "value": "val1"}`))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/write", `{"address": "addr1", "value": "val1", "writeId": "w1"}`))
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, "/write", `{"address": "addr1", "value": "val2", "writeId": "w2"}`))
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/confirm", `{"address": "addr1", "writeId": "w1"}`))
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPut, "/confirm", `{"address": "addr1", "writeId": "w2", "timestamp": {"wallTime": 1}}`))
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPut, "/confirm", `{"address": "addr2", "writeId": "w2", "timestamp": {"wallTime": 1}}`))
+
+	n.Flags.RefuseRead = true
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodGet, "/read?address=addr1", ""))
+}
@@ -9,13 +9,22 @@ import (
 	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
 )
 
-func (n *Node) StartHTTP() {
-	log.Printf("Running node %d on port %d\n", n.ID, n.Port)
-	server := &http.Server{
+// NewServer returns a server for the node on its port
+func (n *Node) NewServer() *http.Server {
+	return &http.Server{
 		Addr:    fmt.Sprintf(":%d", n.Port),
 		Handler: n,
 	}
-	n.Server = server
+}
+
+// StartHTTP serves the node until its server is closed. It uses n.Server if it's already set,
+// so the server can be closed from another goroutine without waiting for StartHTTP to set it.
+func (n *Node) StartHTTP() {
+	log.Printf("Running node %d on port %d\n", n.ID, n.Port)
+	if n.Server == nil {
+		n.Server = n.NewServer()
+	}
+	server := n.Server
 
 	if err := server.ListenAndServe(); err != nil {
 		if err != http.ErrServerClosed {
@@ -27,6 +36,13 @@ func (n *Node) StartHTTP() {
 func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Node %d received request: %s\n", n.ID, r.URL.Path)
 
+	// The response's timestamp comes after the request's, and after everything the node has stored
+	if err := n.clock.Receive(r.Header); err != nil {
+		shared.WriteError(w, shared.BadRequest("%s", err))
+		return
+	}
+	n.clock.Send(w.Header())
+
 	switch r.URL.Path {
 	case "/read":
 		if r.Method != http.MethodGet {
@@ -59,6 +75,7 @@ func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		shouldInclude, err := n.WriteResolver(w, r)
 		if err != nil {
 			shared.WriteError(w, err)
+			return
 		}
 
 		res := shared.NodeWriteRes{
@@ -80,6 +97,17 @@ func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			shared.WriteError(w, err)
 		}
 
+		return
+	case "/abort":
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := n.AbortResolver(w, r); err != nil {
+			shared.WriteError(w, err)
+		}
+
 		return
 	case "/update":
 		if r.Method != http.MethodPut {
@@ -87,7 +115,120 @@ func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := n.UpdateResolver(w, r); err != nil {
+		res, err := n.UpdateResolver(w, r)
+		if err != nil {
+			shared.WriteError(w, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			shared.WriteError(w, err)
+		}
+
+		return
+	case "/state":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		addr := r.URL.Query().Get("address")
+		ad, shouldInclude, err := n.State(addr)
+		if err != nil {
+			shared.WriteError(w, err)
+			return
+		}
+
+		res := ad.State(addr, shouldInclude)
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			shared.WriteError(w, err)
+		}
+
+		return
+	case "/pending":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		res := shared.NodePendingRes{
+			Pending: n.StalePending(),
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			shared.WriteError(w, err)
+		}
+
+		return
+	case "/status":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(n.Status()); err != nil {
+			shared.WriteError(w, err)
+		}
+
+		return
+	case "/dump":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		states, err := n.Dump()
+		if err != nil {
+			shared.WriteError(w, err)
+			return
+		}
+
+		res := shared.NodeDumpRes{
+			States: states,
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			shared.WriteError(w, err)
+		}
+
+		return
+	case "/admin/snapshot":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		path, err := n.Snapshot()
+		if err != nil {
+			shared.WriteError(w, err)
+			return
+		}
+
+		res := shared.NodeSnapshotRes{
+			Path: path,
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			shared.WriteError(w, err)
+		}
+
+		return
+	case "/admin/flags":
+		if r.Method == http.MethodPost {
+			var req shared.NodeFlags
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				shared.WriteError(w, shared.BadRequest("Invalid request body: %s", err))
+				return
+			}
+
+			n.SetRefuseFlags(req)
+		} else if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(n.RefuseFlags()); err != nil {
 			shared.WriteError(w, err)
 		}
 
@@ -99,35 +240,59 @@ func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (n *Node) ReadResolver(w http.ResponseWriter, r *http.Request) (shared.ValueVersion, bool, error) {
 	addr := r.URL.Query().Get("address")
-	return n.Read(addr)
+	return n.Read(r.Context(), addr)
 }
 
 func (n *Node) WriteResolver(w http.ResponseWriter, r *http.Request) (bool, error) {
 	var req shared.WriteReq
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		return false, err
+		return false, shared.BadRequest("Invalid request body: %s", err)
 	}
 
-	return n.Write(req.Address, req.Value)
+	if req.ExpectedVersion != nil {
+		return n.CompareAndWrite(r.Context(), req.Address, req.Value, req.WriteID, *req.ExpectedVersion)
+	}
+	return n.Write(r.Context(), req.Address, req.Value, req.WriteID)
 }
 
 func (n *Node) ConfirmResolver(w http.ResponseWriter, r *http.Request) error {
 	var req shared.ConfirmReq
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		return err
+		return shared.BadRequest("Invalid request body: %s", err)
+	}
+
+	return n.ConfirmAt(r.Context(), req.Address, req.WriteID, req.Timestamp)
+}
+
+func (n *Node) AbortResolver(w http.ResponseWriter, r *http.Request) error {
+	var req shared.AbortReq
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return shared.BadRequest("Invalid request body: %s", err)
 	}
 
-	return n.Confirm(req.Address)
+	return n.Abort(r.Context(), req.Address, req.WriteID)
 }
 
-func (n *Node) UpdateResolver(w http.ResponseWriter, r *http.Request) error {
+func (n *Node) UpdateResolver(w http.ResponseWriter, r *http.Request) (shared.NodeUpdateRes, error) {
 	var req shared.UpdateReq
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		return err
+		return shared.NodeUpdateRes{}, shared.BadRequest("Invalid request body: %s", err)
 	}
 
-	return n.Update(req.Address, req.Value, req.Version)
+	applied, err := n.Update(r.Context(), req.Address, req.ValueVersion)
+	if err != nil {
+		return shared.NodeUpdateRes{}, err
+	}
+
+	// The update was either applied or ignored because the address was already at least as new
+	ad, _ := n.Storage.Get(req.Address)
+
+	return shared.NodeUpdateRes{
+		Applied: applied,
+		Version: ad.ValueVersion.Version,
+	}, nil
 }
@@ -0,0 +1,85 @@
+package node
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// numShards is how many independently locked shards a shardMap is split into
+const numShards = 64
+
+// shardMap is a map of AddressData split into shards, each with its own RW lock.
+// Reads only share a shard's lock, so they don't contend with each other, and writes
+// only block the addresses in the same shard.
+type shardMap struct {
+	seed   maphash.Seed
+	shards [numShards]shard
+}
+
+type shard struct {
+	mu     sync.RWMutex
+	memory map[string]AddressData
+}
+
+func newShardMap() *shardMap {
+	m := &shardMap{seed: maphash.MakeSeed()}
+	for i := range m.shards {
+		m.shards[i].memory = make(map[string]AddressData)
+	}
+	return m
+}
+
+func (m *shardMap) shard(addr string) *shard {
+	return &m.shards[maphash.String(m.seed, addr)%numShards]
+}
+
+func (m *shardMap) get(addr string) (AddressData, bool) {
+	s := m.shard(addr)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ad, ok := s.memory[addr]
+	return ad, ok
+}
+
+func (m *shardMap) put(addr string, ad AddressData) {
+	s := m.shard(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.memory[addr] = ad
+}
+
+// iterate calls fn on every address one shard at a time, so it isn't a point-in-time view
+// of the whole map. fn must not modify the map.
+func (m *shardMap) iterate(fn func(addr string, ad AddressData)) {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for addr, ad := range s.memory {
+			fn(addr, ad)
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// copy returns every address in a plain map. Unlike iterate, it holds every shard's lock at
+// once, so the copy is a point-in-time view.
+func (m *shardMap) copy() map[string]AddressData {
+	for i := range m.shards {
+		m.shards[i].mu.RLock()
+	}
+	defer func() {
+		for i := range m.shards {
+			m.shards[i].mu.RUnlock()
+		}
+	}()
+
+	memory := make(map[string]AddressData)
+	for i := range m.shards {
+		for addr, ad := range m.shards[i].memory {
+			memory[addr] = ad
+		}
+	}
+	return memory
+}
@@ -0,0 +1,129 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot is a point-in-time copy of every address a node stores, including pending values
+type Snapshot struct {
+	CreatedAt time.Time `json:"createdAt"`
+	// Segment is the first log segment that isn't covered by the snapshot.
+	// It is only meaningful to the LogStorage that wrote the snapshot.
+	Segment int                    `json:"segment,omitempty"`
+	Entries map[string]AddressData `json:"entries"`
+}
+
+// WriteSnapshot atomically replaces the file at path with snap
+func WriteSnapshot(path string, snap Snapshot) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial snapshot at path
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func ReadSnapshot(path string) (Snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return Snapshot{}, fmt.Errorf("Invalid snapshot %s: %w", path, err)
+	}
+	if snap.Entries == nil {
+		snap.Entries = make(map[string]AddressData)
+	}
+
+	return snap, nil
+}
+
+// Snapshot writes a snapshot of the node's memory, returning where it was written
+func (n *Node) Snapshot() (string, error) {
+	path, err := n.Storage.Snapshot()
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Node %d wrote snapshot to %s", n.ID, path)
+	return path, nil
+}
+
+// Restore loads every address in the snapshot at path into the node's storage,
+// replacing whatever was stored at those addresses. It should be called before the node
+// starts serving requests.
+func (n *Node) Restore(path string) error {
+	snap, err := ReadSnapshot(path)
+	if err != nil {
+		return err
+	}
+
+	for addr, ad := range snap.Entries {
+		if err := n.Storage.Update(addr, ad); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Node %d restored %d addresses from snapshot %s taken at %v", n.ID, len(snap.Entries), path, snap.CreatedAt)
+	return nil
+}
+
+// StartSnapshots snapshots the node's memory every interval until the node is closed
+func (n *Node) StartSnapshots(interval time.Duration) {
+	n.snapshotStop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := n.Snapshot(); err != nil {
+					log.Printf("Node %d failed to write snapshot: %s", n.ID, err)
+				}
+			}
+		}
+	}(n.snapshotStop)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
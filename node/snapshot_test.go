@@ -0,0 +1,108 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotCompactsLog(t *testing.T) {
+	config := LogStorageConfig{Dir: t.TempDir()}
+
+	n, err := newLogNode(config)
+	assert.Nil(t, err)
+
+	_, err = n.Write(context.Background(), "addr1", "val1", "w1")
+	assert.Nil(t, err)
+	err = n.Confirm(context.Background(), "addr1", "w1")
+	assert.Nil(t, err)
+	_, err = n.Write(context.Background(), "addr1", "val2", "w2")
+	assert.Nil(t, err)
+
+	path, err := n.Snapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(config.Dir, snapshotFile), path)
+
+	// Only the segment started by the snapshot is left
+	segments, err := filepath.Glob(filepath.Join(config.Dir, "wal-*.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(config.Dir, "wal-00000002.log")}, segments)
+
+	_, err = n.Update(context.Background(), "addr2", shared.ValueVersion{Value: "val3", Version: 2, WriteID: "w3"})
+	assert.Nil(t, err)
+	assert.Nil(t, n.Close())
+
+	// The snapshot and the segment after it are enough to rebuild memory
+	restarted, err := newLogNode(config)
+	assert.Nil(t, err)
+	defer restarted.Close()
+	assert.Equal(t, dumpStorage(n.Storage), dumpStorage(restarted.Storage))
+
+	ad, _ := restarted.Storage.Get("addr1")
+	assert.Equal(t, "val1", ad.ValueVersion.Value)
+	assert.Equal(t, "val2", *ad.PendingValue)
+}
+
+func TestRestore(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.SnapshotPath = filepath.Join(t.TempDir(), "snapshot.json")
+	n := NewWithStorage(0, 8080, 1, 1, storage)
+
+	_, err := n.Write(context.Background(), "addr1", "val1", "w1")
+	assert.Nil(t, err)
+	err = n.Confirm(context.Background(), "addr1", "w1")
+	assert.Nil(t, err)
+	_, err = n.Write(context.Background(), "addr2", "val2", "w2")
+	assert.Nil(t, err)
+
+	path, err := n.Snapshot()
+	assert.Nil(t, err)
+
+	replacement := New(0, 8080, 1, 1)
+	err = replacement.Restore(path)
+	assert.Nil(t, err)
+	assert.Equal(t, dumpStorage(n.Storage), dumpStorage(replacement.Storage))
+
+	vv, _, err := replacement.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", vv.Value)
+	assert.Equal(t, 1, vv.Version)
+
+	// The pending value was restored too
+	err = replacement.Confirm(context.Background(), "addr2", "w2")
+	assert.Nil(t, err)
+}
+
+func TestSnapshotEndpoint(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.SnapshotPath = filepath.Join(t.TempDir(), "snapshot.json")
+	n := NewWithStorage(0, 8080, 1, 1, storage)
+
+	_, err := n.Write(context.Background(), "addr1", "val1", "w1")
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	n.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res shared.NodeSnapshotRes
+	err = json.NewDecoder(w.Body).Decode(&res)
+	assert.Nil(t, err)
+	assert.Equal(t, storage.SnapshotPath, res.Path)
+
+	snap, err := ReadSnapshot(res.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", *snap.Entries["addr1"].PendingValue)
+
+	// Snapshots can't be taken without a path
+	n = New(0, 8080, 1, 1)
+	w = httptest.NewRecorder()
+	n.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
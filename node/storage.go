@@ -0,0 +1,326 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Storage is where a node keeps the AddressData for every address.
+// Node serializes changes to a given address with its per-address mutex, but reads
+// don't take it, so Get must be safe to call while the same address is being stored.
+type Storage interface {
+	// Get returns the data at addr, and whether the address has been seen before
+	Get(addr string) (AddressData, bool)
+	// PutPending stores ad, which carries a new pending value, at addr
+	PutPending(addr string, ad AddressData) error
+	// Confirm stores ad, which carries a newly confirmed value, at addr
+	Confirm(addr string, ad AddressData) error
+	// Update stores ad, which carries a forcibly updated value, at addr
+	Update(addr string, ad AddressData) error
+	// Abort stores ad, which no longer has a pending value, at addr
+	Abort(addr string, ad AddressData) error
+	// Iterate calls fn on every stored address. Order is not defined.
+	Iterate(fn func(addr string, ad AddressData))
+	// Snapshot writes a point-in-time snapshot of every address and returns its path.
+	// Engines that keep history may discard whatever the snapshot covers.
+	Snapshot() (string, error)
+	Close() error
+}
+
+// MemoryStorage keeps everything in process. Nothing survives a restart.
+type MemoryStorage struct {
+	// SnapshotPath is where Snapshot writes to. Snapshots are disabled if it is empty.
+	SnapshotPath string
+
+	memory *shardMap
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		memory: newShardMap(),
+	}
+}
+
+func (s *MemoryStorage) Get(addr string) (AddressData, bool) {
+	return s.memory.get(addr)
+}
+
+func (s *MemoryStorage) PutPending(addr string, ad AddressData) error {
+	s.put(addr, ad)
+	return nil
+}
+
+func (s *MemoryStorage) Confirm(addr string, ad AddressData) error {
+	s.put(addr, ad)
+	return nil
+}
+
+func (s *MemoryStorage) Update(addr string, ad AddressData) error {
+	s.put(addr, ad)
+	return nil
+}
+
+func (s *MemoryStorage) Abort(addr string, ad AddressData) error {
+	s.put(addr, ad)
+	return nil
+}
+
+// Iterate doesn't see a point-in-time view of every address, since other addresses can
+// change while it runs
+func (s *MemoryStorage) Iterate(fn func(addr string, ad AddressData)) {
+	s.memory.iterate(fn)
+}
+
+func (s *MemoryStorage) Snapshot() (string, error) {
+	if s.SnapshotPath == "" {
+		return "", errors.New("Memory storage has no snapshot path")
+	}
+
+	snap := Snapshot{
+		CreatedAt: time.Now().UTC(),
+		Entries:   s.memory.copy(),
+	}
+
+	return s.SnapshotPath, WriteSnapshot(s.SnapshotPath, snap)
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+func (s *MemoryStorage) put(addr string, ad AddressData) {
+	s.memory.put(addr, ad)
+}
+
+// LogStorageConfig configures a LogStorage
+type LogStorageConfig struct {
+	// Dir holds the log segments and the latest snapshot
+	Dir      string
+	Policy   SyncPolicy
+	Interval time.Duration
+}
+
+const snapshotFile = "snapshot.json"
+
+// LogStorage is an append-only log-structured store. Every mutation is appended to a
+// write-ahead log before it is applied to an in-memory index.
+//
+// The log is split into numbered segments. Taking a snapshot starts a new segment and
+// deletes the older ones, since the snapshot covers them. Opening the store loads the
+// latest snapshot and replays the segments written after it.
+type LogStorage struct {
+	config LogStorageConfig
+	index  *MemoryStorage
+
+	// mu is held for reading while appending and for writing while switching segments,
+	// so a snapshot never sees a record that is in the log but not in the index
+	mu      sync.RWMutex
+	wal     *WAL
+	segment int
+
+	snapshotMu sync.Mutex
+}
+
+func OpenLogStorage(config LogStorageConfig) (*LogStorage, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &LogStorage{
+		config:  config,
+		index:   NewMemoryStorage(),
+		segment: 1,
+	}
+
+	snap, err := ReadSnapshot(s.snapshotPath())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		for addr, ad := range snap.Entries {
+			s.index.put(addr, ad)
+		}
+		s.segment = snap.Segment
+		log.Printf("Loaded %d addresses from snapshot %s", len(snap.Entries), s.snapshotPath())
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	replayed := 0
+	for _, segment := range segments {
+		if segment < s.segment {
+			// Left behind by a crash between writing a snapshot and compacting
+			if err := os.Remove(s.segmentPath(segment)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		wal, err := OpenWAL(s.walConfig(segment))
+		if err != nil {
+			return nil, err
+		}
+
+		err = wal.Replay(func(rec walRecord) {
+			s.index.put(rec.Address, rec.Data)
+			replayed++
+		})
+		if err != nil {
+			wal.Close()
+			return nil, err
+		}
+
+		if s.wal != nil {
+			s.wal.Close()
+		}
+		s.wal = wal
+		s.segment = segment
+	}
+
+	if s.wal == nil {
+		if s.wal, err = OpenWAL(s.walConfig(s.segment)); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Replayed %d records from %s", replayed, config.Dir)
+
+	return s, nil
+}
+
+func (s *LogStorage) Get(addr string) (AddressData, bool) {
+	return s.index.Get(addr)
+}
+
+func (s *LogStorage) PutPending(addr string, ad AddressData) error {
+	return s.append(walWrite, addr, ad)
+}
+
+func (s *LogStorage) Confirm(addr string, ad AddressData) error {
+	return s.append(walConfirm, addr, ad)
+}
+
+func (s *LogStorage) Update(addr string, ad AddressData) error {
+	return s.append(walUpdate, addr, ad)
+}
+
+func (s *LogStorage) Abort(addr string, ad AddressData) error {
+	return s.append(walAbort, addr, ad)
+}
+
+func (s *LogStorage) Iterate(fn func(addr string, ad AddressData)) {
+	s.index.Iterate(fn)
+}
+
+// Snapshot writes the index to the snapshot in the storage directory and deletes every
+// log segment the snapshot covers
+func (s *LogStorage) Snapshot() (string, error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	// Switch to a new segment, so everything before it is covered by the snapshot
+	s.mu.Lock()
+	entries := s.index.memory.copy()
+	next := s.segment + 1
+	wal, err := OpenWAL(s.walConfig(next))
+	if err != nil {
+		s.mu.Unlock()
+		return "", err
+	}
+	prev := s.wal
+	s.wal = wal
+	s.segment = next
+	s.mu.Unlock()
+
+	if err := prev.Close(); err != nil {
+		return "", err
+	}
+
+	snap := Snapshot{
+		CreatedAt: time.Now().UTC(),
+		Segment:   next,
+		Entries:   entries,
+	}
+	if err := WriteSnapshot(s.snapshotPath(), snap); err != nil {
+		return "", err
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return "", err
+	}
+	for _, segment := range segments {
+		if segment < next {
+			if err := os.Remove(s.segmentPath(segment)); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return s.snapshotPath(), nil
+}
+
+func (s *LogStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.wal.Close()
+}
+
+func (s *LogStorage) append(op walOp, addr string, ad AddressData) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.wal.Append(walRecord{Op: op, Address: addr, Data: ad}); err != nil {
+		return fmt.Errorf("Failed to log %s to address %s: %w", op, addr, err)
+	}
+
+	s.index.put(addr, ad)
+	return nil
+}
+
+func (s *LogStorage) snapshotPath() string {
+	return filepath.Join(s.config.Dir, snapshotFile)
+}
+
+func (s *LogStorage) segmentPath(segment int) string {
+	return filepath.Join(s.config.Dir, fmt.Sprintf("wal-%08d.log", segment))
+}
+
+func (s *LogStorage) walConfig(segment int) WALConfig {
+	return WALConfig{
+		Path:     s.segmentPath(segment),
+		Policy:   s.config.Policy,
+		Interval: s.config.Interval,
+	}
+}
+
+// segments returns the numbers of every log segment in the storage directory, in ascending order
+func (s *LogStorage) segments() ([]int, error) {
+	paths, err := filepath.Glob(filepath.Join(s.config.Dir, "wal-*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []int
+	for _, path := range paths {
+		var segment int
+		if _, err := fmt.Sscanf(filepath.Base(path), "wal-%08d.log", &segment); err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+
+	sort.Ints(segments)
+	return segments, nil
+}
@@ -0,0 +1,118 @@
+package node
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogStorageReplay(t *testing.T) {
+	config := LogStorageConfig{Dir: t.TempDir()}
+
+	n, err := newLogNode(config)
+	assert.Nil(t, err)
+
+	_, err = n.Write(context.Background(), "addr1", "val1", "w1")
+	assert.Nil(t, err)
+	err = n.Confirm(context.Background(), "addr1", "w1")
+	assert.Nil(t, err)
+	_, err = n.Write(context.Background(), "addr1", "val2", "w2")
+	assert.Nil(t, err)
+	_, err = n.Update(context.Background(), "addr2", shared.ValueVersion{Value: "val3", Version: 4, WriteID: "w3"})
+	assert.Nil(t, err)
+	assert.Nil(t, n.Close())
+
+	// Simulate a restart
+	restarted, err := newLogNode(config)
+	assert.Nil(t, err)
+	defer restarted.Close()
+
+	assert.Equal(t, dumpStorage(n.Storage), dumpStorage(restarted.Storage))
+
+	vv, _, err := restarted.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", vv.Value)
+	assert.Equal(t, 1, vv.Version)
+
+	// The pending value survived the restart, so it can still be confirmed
+	err = restarted.Confirm(context.Background(), "addr1", "w2")
+	assert.Nil(t, err)
+	vv, _, err = restarted.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val2", vv.Value)
+	assert.Equal(t, 2, vv.Version)
+
+	vv, _, err = restarted.Read(context.Background(), "addr2")
+	assert.Nil(t, err)
+	assert.Equal(t, "val3", vv.Value)
+	assert.Equal(t, 4, vv.Version)
+}
+
+func TestLogStorageTornRecord(t *testing.T) {
+	config := LogStorageConfig{Dir: t.TempDir(), Policy: SyncNever}
+
+	n, err := newLogNode(config)
+	assert.Nil(t, err)
+	_, err = n.Write(context.Background(), "addr1", "val1", "w1")
+	assert.Nil(t, err)
+	err = n.Confirm(context.Background(), "addr1", "w1")
+	assert.Nil(t, err)
+	assert.Nil(t, n.Close())
+
+	// Crash in the middle of appending a record
+	f, err := os.OpenFile(filepath.Join(config.Dir, "wal-00000001.log"), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(`{"op":"write","address":"addr1","da`)
+	assert.Nil(t, err)
+	f.Close()
+
+	restarted, err := newLogNode(config)
+	assert.Nil(t, err)
+
+	vv, _, err := restarted.Read(context.Background(), "addr1")
+	assert.Nil(t, err)
+	assert.Equal(t, "val1", vv.Value)
+	ad, _ := restarted.Storage.Get("addr1")
+	assert.Nil(t, ad.PendingValue)
+
+	// New records are appended after the truncated one
+	_, err = restarted.Write(context.Background(), "addr1", "val2", "w2")
+	assert.Nil(t, err)
+	assert.Nil(t, restarted.Close())
+
+	restarted, err = newLogNode(config)
+	assert.Nil(t, err)
+	defer restarted.Close()
+	ad, _ = restarted.Storage.Get("addr1")
+	assert.Equal(t, "val2", *ad.PendingValue)
+}
+
+func TestLogStorageCorruptRecord(t *testing.T) {
+	config := LogStorageConfig{Dir: t.TempDir()}
+
+	err := os.WriteFile(filepath.Join(config.Dir, "wal-00000001.log"), []byte("not json\n{}\n"), 0644)
+	assert.Nil(t, err)
+
+	_, err = newLogNode(config)
+	assert.NotNil(t, err)
+}
+
+func newLogNode(config LogStorageConfig) (*Node, error) {
+	storage, err := OpenLogStorage(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithStorage(0, 8080, 1, 1, storage), nil
+}
+
+func dumpStorage(s Storage) map[string]AddressData {
+	memory := make(map[string]AddressData)
+	s.Iterate(func(addr string, ad AddressData) {
+		memory[addr] = ad
+	})
+	return memory
+}
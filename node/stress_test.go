@@ -0,0 +1,160 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shekarramaswamy4/shared-register-abstraction/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConcurrentStress runs writers, readers and inspection against the same addresses at
+// once. Run it with -race.
+func TestConcurrentStress(t *testing.T) {
+	logNode, err := newLogNode(LogStorageConfig{Dir: t.TempDir()})
+	assert.Nil(t, err)
+	defer logNode.Close()
+
+	nodes := map[string]*Node{
+		"memory": New(0, 8080, 1, 1),
+		"log":    logNode,
+	}
+
+	for name, n := range nodes {
+		t.Run(name, func(t *testing.T) {
+			stress(t, n)
+		})
+	}
+}
+
+func stress(t *testing.T, n *Node) {
+	const numAddrs = 8
+	const numWriters = 8
+	const numReaders = 8
+	const writesPerWriter = 200
+
+	addrs := make([]string, numAddrs)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("addr%d", i)
+	}
+
+	// confirmed counts the writes confirmed at each address, which is the version it should end at
+	confirmed := make([]atomic.Int64, numAddrs)
+	ctx := context.Background()
+
+	var writers sync.WaitGroup
+	for w := 0; w < numWriters; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			for i := 0; i < writesPerWriter; i++ {
+				a := (w + i) % numAddrs
+				writeID := fmt.Sprintf("w%d-%d", w, i)
+
+				// Writes to an address with a pending value are rejected, and those are aborted
+				if _, err := n.Write(ctx, addrs[a], writeID, writeID); err != nil {
+					continue
+				}
+				if i%4 == 0 {
+					assert.Nil(t, n.Abort(ctx, addrs[a], writeID))
+					continue
+				}
+				if err := n.Confirm(ctx, addrs[a], writeID); err == nil {
+					confirmed[a].Add(1)
+				}
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := 0; r < numReaders; r++ {
+		readers.Add(1)
+		go func(r int) {
+			defer readers.Done()
+
+			// Versions only move forward
+			seen := make([]int, numAddrs)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				for a, addr := range addrs {
+					vv, _, err := n.Read(ctx, addr)
+					if err != nil {
+						continue
+					}
+					assert.GreaterOrEqual(t, vv.Version, seen[a])
+					seen[a] = vv.Version
+				}
+
+				switch r {
+				case 0:
+					n.Status()
+				case 1:
+					_, err := n.Dump()
+					assert.Nil(t, err)
+				case 2:
+					n.StalePending()
+				case 3:
+					n.SetRefuseFlags(shared.NodeFlags{})
+					n.RefuseFlags()
+				case 4:
+					if _, ok := n.Storage.(*LogStorage); ok {
+						_, err := n.Snapshot()
+						assert.Nil(t, err)
+					}
+				}
+			}
+		}(r)
+	}
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	for a, addr := range addrs {
+		vv, _, err := n.Read(ctx, addr)
+		if confirmed[a].Load() == 0 {
+			assert.NotNil(t, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, int(confirmed[a].Load()), vv.Version)
+	}
+}
+
+func BenchmarkParallelRead(b *testing.B) {
+	// Reads log every call, which would otherwise be most of what's measured
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	n := New(0, 8080, 1, 1)
+	ctx := context.Background()
+
+	addrs := make([]string, 1024)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("addr%d", i)
+		writeID := fmt.Sprintf("w%d", i)
+		n.Write(ctx, addrs[i], "val", writeID)
+		n.Confirm(ctx, addrs[i], writeID)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			n.Read(ctx, addrs[i%len(addrs)])
+			i++
+		}
+	})
+}
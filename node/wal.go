@@ -0,0 +1,188 @@
+package node
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls how often the write-ahead log is fsynced to disk
+type SyncPolicy string
+
+const (
+	// SyncAlways fsyncs after every record, before the operation is acknowledged
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsyncs in the background every WALConfig.Interval. A crash can lose
+	// records appended since the last sync.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing entirely to the operating system
+	SyncNever SyncPolicy = "never"
+)
+
+type WALConfig struct {
+	Path     string
+	Policy   SyncPolicy
+	Interval time.Duration
+}
+
+type walOp string
+
+const (
+	walWrite   walOp = "write"
+	walConfirm walOp = "confirm"
+	walUpdate  walOp = "update"
+	walAbort   walOp = "abort"
+)
+
+// walRecord is a single entry in the write-ahead log.
+// Records hold the full AddressData an operation produced rather than the operation's
+// arguments, so replaying them doesn't depend on the clock or on the order of pending timeouts.
+type walRecord struct {
+	Op      walOp       `json:"op"`
+	Address string      `json:"address"`
+	Data    AddressData `json:"data"`
+}
+
+// WAL is an append-only log of every mutation made to a node's memory.
+// Records are newline delimited JSON.
+type WAL struct {
+	mu     sync.Mutex
+	file   *os.File
+	config WALConfig
+	dirty  bool
+	done   chan struct{}
+}
+
+func OpenWAL(config WALConfig) (*WAL, error) {
+	if config.Policy == "" {
+		config.Policy = SyncAlways
+	}
+
+	switch config.Policy {
+	case SyncAlways, SyncNever:
+	case SyncInterval:
+		if config.Interval <= 0 {
+			return nil, fmt.Errorf("Sync interval must be positive, got %v", config.Interval)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown sync policy %s", config.Policy)
+	}
+
+	file, err := os.OpenFile(config.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WAL{
+		file:   file,
+		config: config,
+		done:   make(chan struct{}),
+	}
+
+	if config.Policy == SyncInterval {
+		go w.syncLoop()
+	}
+
+	return w, nil
+}
+
+// Append writes rec to the log, syncing according to the configured policy.
+// The record is durable (under SyncAlways) once Append returns.
+func (w *WAL) Append(rec walRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.file.Write(b); err != nil {
+		return err
+	}
+
+	switch w.config.Policy {
+	case SyncAlways:
+		return w.file.Sync()
+	case SyncInterval:
+		w.dirty = true
+	}
+
+	return nil
+}
+
+// Replay calls fn on every record in the log, in the order they were appended.
+// A partially written record at the end of the log, left behind by a crash in the middle
+// of an append, is truncated. A malformed record anywhere else is an error.
+func (w *WAL) Replay(fn func(rec walRecord)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(w.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) == 0 {
+			break
+		}
+
+		var rec walRecord
+		if err == io.EOF || json.Unmarshal(line, &rec) != nil {
+			if _, peekErr := reader.Peek(1); peekErr != io.EOF {
+				return fmt.Errorf("Corrupt write-ahead log record at offset %d in %s", offset, w.config.Path)
+			}
+			// Torn trailing record, drop it
+			return w.file.Truncate(offset)
+		}
+
+		fn(rec)
+		offset += int64(len(line))
+	}
+
+	return nil
+}
+
+func (w *WAL) syncLoop() {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.dirty {
+				if err := w.file.Sync(); err == nil {
+					w.dirty = false
+				}
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Close syncs any outstanding records and closes the log
+func (w *WAL) Close() error {
+	if w.config.Policy == SyncInterval {
+		close(w.done)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return errors.Join(w.file.Sync(), w.file.Close())
+}
@@ -0,0 +1,167 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrorCode is the kind of an Error, which decides its HTTP status
+type ErrorCode string
+
+const (
+	CodeNotFound ErrorCode = "not-found"
+	// CodeConflict means the request disagrees with the address's state, such as another
+	// write's pending value or an unexpected version
+	CodeConflict ErrorCode = "conflict"
+	// CodeUnavailable means the node is refusing requests
+	CodeUnavailable ErrorCode = "unavailable"
+	// CodeQuorumFailed means too few nodes accepted a request for it to succeed
+	CodeQuorumFailed ErrorCode = "quorum-failed"
+	CodeBadRequest   ErrorCode = "bad-request"
+	CodeInternal     ErrorCode = "internal"
+)
+
+// StatusCode returns the HTTP status errors with the code are served with
+func (c ErrorCode) StatusCode() int {
+	switch c {
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeConflict:
+		return http.StatusConflict
+	case CodeUnavailable, CodeQuorumFailed:
+		return http.StatusServiceUnavailable
+	case CodeBadRequest:
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Error is an error that keeps its kind when it's sent over HTTP
+type Error struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches errors with the same code, so callers can check errors.Is(err, shared.ErrNotFound)
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+var (
+	ErrNotFound     = &Error{Code: CodeNotFound, Message: "Not found"}
+	ErrConflict     = &Error{Code: CodeConflict, Message: "Conflict"}
+	ErrUnavailable  = &Error{Code: CodeUnavailable, Message: "Unavailable"}
+	ErrQuorumFailed = &Error{Code: CodeQuorumFailed, Message: "Quorum failed"}
+	ErrBadRequest   = &Error{Code: CodeBadRequest, Message: "Bad request"}
+)
+
+func NotFound(format string, args ...interface{}) error {
+	return &Error{Code: CodeNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func Conflict(format string, args ...interface{}) error {
+	return &Error{Code: CodeConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+func Unavailable(format string, args ...interface{}) error {
+	return &Error{Code: CodeUnavailable, Message: fmt.Sprintf(format, args...)}
+}
+
+func QuorumFailed(format string, args ...interface{}) error {
+	return &Error{Code: CodeQuorumFailed, Message: fmt.Sprintf(format, args...)}
+}
+
+func BadRequest(format string, args ...interface{}) error {
+	return &Error{Code: CodeBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// ConflictError is returned when a compare-and-swap expects a different version than the
+// one that is stored
+type ConflictError struct {
+	Address         string `json:"address"`
+	ExpectedVersion int    `json:"expectedVersion"`
+	ObservedVersion int    `json:"observedVersion"`
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Address %s is at version %d, expected version %d", e.Address, e.ObservedVersion, e.ExpectedVersion)
+}
+
+// Is makes a ConflictError match ErrConflict
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ErrorRes is the body of an error response
+type ErrorRes struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Conflict is set when a compare-and-swap expected a different version
+	Conflict *ConflictError `json:"conflict,omitempty"`
+}
+
+// WriteError responds with err as JSON. Errors that aren't an *Error or *ConflictError are
+// internal errors.
+func WriteError(w http.ResponseWriter, err error) {
+	res := ErrorRes{
+		Code:    CodeInternal,
+		Message: err.Error(),
+	}
+
+	var typed *Error
+	if errors.As(err, &res.Conflict) {
+		res.Code = CodeConflict
+	} else if errors.As(err, &typed) {
+		res.Code = typed.Code
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(res.Code.StatusCode())
+	json.NewEncoder(w).Encode(res)
+}
+
+// ReadError returns the error in a response written by WriteError, as an *Error or *ConflictError.
+// Responses without an error body get the code that matches their status.
+func ReadError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+
+	var res ErrorRes
+	if err := json.Unmarshal(body, &res); err != nil || res.Code == "" {
+		msg := string(bytes.TrimSpace(body))
+		if msg == "" {
+			msg = fmt.Sprintf("Request failed: %d", resp.StatusCode)
+		}
+		return &Error{Code: codeForStatus(resp.StatusCode), Message: msg}
+	}
+
+	if res.Conflict != nil {
+		return res.Conflict
+	}
+
+	return &Error{Code: res.Code, Message: res.Message}
+}
+
+func codeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	}
+
+	return CodeInternal
+}
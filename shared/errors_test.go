@@ -0,0 +1,60 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorRoundTrip(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		is     error
+	}{
+		{NotFound("Address %s not found", "addr1"), http.StatusNotFound, ErrNotFound},
+		{Conflict("Address %s has a pending value", "addr1"), http.StatusConflict, ErrConflict},
+		{Unavailable("Refusing to read"), http.StatusServiceUnavailable, ErrUnavailable},
+		{QuorumFailed("Writing to quorum not reached"), http.StatusServiceUnavailable, ErrQuorumFailed},
+		{BadRequest("Write ID is required"), http.StatusBadRequest, ErrBadRequest},
+		{fmt.Errorf("Wrapped: %w", NotFound("Address addr1 not found")), http.StatusNotFound, ErrNotFound},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		WriteError(w, test.err)
+		assert.Equal(t, test.status, w.Code)
+
+		err := ReadError(w.Result())
+		assert.ErrorIs(t, err, test.is)
+		assert.Equal(t, test.err.Error(), err.Error())
+	}
+
+	// Compare-and-swap conflicts keep their versions
+	w := httptest.NewRecorder()
+	WriteError(w, &ConflictError{Address: "addr1", ExpectedVersion: 1, ObservedVersion: 3})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var conflict *ConflictError
+	err := ReadError(w.Result())
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, 3, conflict.ObservedVersion)
+
+	// Anything else is internal
+	w = httptest.NewRecorder()
+	WriteError(w, errors.New("Disk full"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	err = ReadError(w.Result())
+	assert.False(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, "Disk full", err.Error())
+
+	// Responses without an error body get the code for their status
+	w = httptest.NewRecorder()
+	w.WriteHeader(http.StatusNotFound)
+	assert.ErrorIs(t, ReadError(w.Result()), ErrNotFound)
+}
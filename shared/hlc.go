@@ -0,0 +1,139 @@
+package shared
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClockHeader carries the sender's hybrid logical clock on every request to a node and every
+// response from one, so the clocks of clients and nodes that talk to each other stay causally ordered
+const ClockHeader = "X-Clock-Timestamp"
+
+// Timestamp is a reading of a hybrid logical clock: a wall time in nanoseconds, and a counter
+// that orders events which happened at the same wall time, or while the wall clock lagged behind
+// a timestamp already seen. If one event could have caused another, its timestamp is earlier.
+type Timestamp struct {
+	WallTime int64 `json:"wallTime"`
+	Logical  int32 `json:"logical"`
+}
+
+// Before reports whether t is earlier than other
+func (t Timestamp) Before(other Timestamp) bool {
+	if t.WallTime != other.WallTime {
+		return t.WallTime < other.WallTime
+	}
+	return t.Logical < other.Logical
+}
+
+func (t Timestamp) IsZero() bool {
+	return t == Timestamp{}
+}
+
+// Time returns the wall time of t, which is within clock skew of when the event happened
+func (t Timestamp) Time() time.Time {
+	return time.Unix(0, t.WallTime).UTC()
+}
+
+func (t Timestamp) String() string {
+	return fmt.Sprintf("%d.%d", t.WallTime, t.Logical)
+}
+
+// ParseTimestamp parses a timestamp formatted by Timestamp.String
+func ParseTimestamp(s string) (Timestamp, error) {
+	wall, logical, ok := strings.Cut(s, ".")
+	if !ok {
+		return Timestamp{}, fmt.Errorf("Invalid timestamp %s", s)
+	}
+
+	wallTime, err := strconv.ParseInt(wall, 10, 64)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("Invalid timestamp %s: %s", s, err)
+	}
+	l, err := strconv.ParseInt(logical, 10, 32)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("Invalid timestamp %s: %s", s, err)
+	}
+
+	return Timestamp{WallTime: wallTime, Logical: int32(l)}, nil
+}
+
+// Clock is a hybrid logical clock. It is safe for concurrent use.
+type Clock struct {
+	mu   sync.Mutex
+	now  func() time.Time
+	last Timestamp
+}
+
+func NewClock() *Clock {
+	return newClock(time.Now)
+}
+
+func newClock(now func() time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns a timestamp for a local event, or for a message about to be sent. It is later
+// than every timestamp the clock has returned or been updated with.
+func (c *Clock) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wallTime := c.now().UnixNano()
+	if wallTime > c.last.WallTime {
+		c.last = Timestamp{WallTime: wallTime}
+	} else {
+		c.last.Logical++
+	}
+
+	return c.last
+}
+
+// Update moves the clock past a timestamp received from another clock, and returns the
+// timestamp of receiving it
+func (c *Clock) Update(remote Timestamp) Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wallTime := c.now().UnixNano()
+	switch {
+	case wallTime > c.last.WallTime && wallTime > remote.WallTime:
+		c.last = Timestamp{WallTime: wallTime}
+	case remote.WallTime > c.last.WallTime:
+		c.last = Timestamp{WallTime: remote.WallTime, Logical: remote.Logical + 1}
+	case c.last.WallTime > remote.WallTime:
+		c.last.Logical++
+	default:
+		// The clock and remote are at the same wall time, which is ahead of the local wall clock
+		if remote.Logical > c.last.Logical {
+			c.last.Logical = remote.Logical
+		}
+		c.last.Logical++
+	}
+
+	return c.last
+}
+
+// Send stamps h with a timestamp for the message it belongs to
+func (c *Clock) Send(h http.Header) {
+	h.Set(ClockHeader, c.Now().String())
+}
+
+// Receive updates the clock with the timestamp in h, if it has one
+func (c *Clock) Receive(h http.Header) error {
+	s := h.Get(ClockHeader)
+	if s == "" {
+		return nil
+	}
+
+	ts, err := ParseTimestamp(s)
+	if err != nil {
+		return err
+	}
+	c.Update(ts)
+
+	return nil
+}
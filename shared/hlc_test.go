@@ -0,0 +1,58 @@
+package shared
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	wall := time.Unix(100, 0)
+	c := newClock(func() time.Time { return wall })
+
+	// Timestamps move forward even when the wall clock doesn't, or goes backwards
+	t1 := c.Now()
+	assert.Equal(t, Timestamp{WallTime: wall.UnixNano()}, t1)
+	t2 := c.Now()
+	assert.True(t, t1.Before(t2))
+	wall = wall.Add(-time.Second)
+	t3 := c.Now()
+	assert.True(t, t2.Before(t3))
+
+	// Receiving a timestamp from a clock that's ahead moves past it
+	remote := Timestamp{WallTime: time.Unix(200, 0).UnixNano(), Logical: 5}
+	t4 := c.Update(remote)
+	assert.Equal(t, Timestamp{WallTime: remote.WallTime, Logical: 6}, t4)
+	assert.True(t, t4.Before(c.Now()))
+
+	// Receiving one from a clock that's behind still ticks
+	t5 := c.Update(t1)
+	assert.True(t, t4.Before(t5))
+
+	// Once the wall clock passes every timestamp seen, it takes over
+	wall = time.Unix(300, 0)
+	assert.Equal(t, Timestamp{WallTime: wall.UnixNano()}, c.Update(remote))
+	assert.Equal(t, wall.UTC(), c.Now().Time())
+}
+
+func TestClockHeader(t *testing.T) {
+	sender := newClock(func() time.Time { return time.Unix(200, 0) })
+	receiver := newClock(func() time.Time { return time.Unix(100, 0) })
+
+	h := http.Header{}
+	sender.Send(h)
+	sent, err := ParseTimestamp(h.Get(ClockHeader))
+	assert.Nil(t, err)
+
+	assert.Nil(t, receiver.Receive(h))
+	assert.True(t, sent.Before(receiver.Now()))
+
+	// Requests without a clock are allowed, but not malformed clocks
+	assert.Nil(t, receiver.Receive(http.Header{}))
+	h.Set(ClockHeader, "200")
+	assert.NotNil(t, receiver.Receive(h))
+	_, err = ParseTimestamp("200.x")
+	assert.NotNil(t, err)
+}
@@ -1,29 +1,93 @@
 package shared
 
-import "net/http"
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
 
-func WriteError(w http.ResponseWriter, err error) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Write([]byte(err.Error()))
+// CreateURL returns the URL of path on node. Nodes are addressed by host:port, or by a URL
+// such as https://host:port when they aren't served over plain HTTP.
+func CreateURL(node, path string) string {
+	if strings.Contains(node, "://") {
+		return strings.TrimSuffix(node, "/") + path
+	}
+	return "http://" + node + path
 }
 
-func CreateURL(port, path string) string {
-	return "http://localhost:" + port + path
+// ValidateNodeAddr checks that node is a host:port or an HTTP(S) URL
+func ValidateNodeAddr(node string) error {
+	if !strings.Contains(node, "://") {
+		if _, _, err := net.SplitHostPort(node); err != nil {
+			return fmt.Errorf("Invalid node address %s: %s", node, err)
+		}
+		return nil
+	}
+
+	u, err := url.Parse(node)
+	if err != nil {
+		return fmt.Errorf("Invalid node address %s: %s", node, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid node address %s, expected host:port or an http(s) URL", node)
+	}
+
+	return nil
+}
+
+// NodePort returns the port in node's address, which is the port the node listens on
+func NodePort(node string) (int, error) {
+	if err := ValidateNodeAddr(node); err != nil {
+		return 0, err
+	}
+
+	host := node
+	if u, err := url.Parse(node); err == nil && strings.Contains(node, "://") {
+		host = u.Host
+	}
+
+	_, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return 0, fmt.Errorf("Node address %s has no port", node)
+	}
+
+	return strconv.Atoi(port)
 }
 
 type WriteReq struct {
 	Address string
 	Value   string
+	// WriteID uniquely identifies the write, so the confirm or abort that follows only
+	// applies to the value this write pre-committed
+	WriteID string
+	// ExpectedVersion makes the write conditional on the address being at this version
+	ExpectedVersion *int `json:",omitempty"`
+}
+
+type CASReq struct {
+	Address         string
+	ExpectedVersion int
+	Value           string
 }
 
 type ConfirmReq struct {
 	Address string
+	WriteID string
+	// Timestamp is when the writer committed the write, and is required
+	Timestamp Timestamp
+}
+
+type AbortReq struct {
+	Address string
+	WriteID string
 }
 
 type UpdateReq struct {
 	Address string
-	Version int
-	Value   string
+	ValueVersion
 }
 
 type NodeReadRes struct {
@@ -34,3 +98,56 @@ type NodeReadRes struct {
 type NodeWriteRes struct {
 	ShouldInclude bool `json:"shouldInclude"`
 }
+
+// NodeUpdateRes reports whether an update was applied, and the version the node holds after it.
+// Updates that aren't newer than what the node holds are ignored.
+type NodeUpdateRes struct {
+	Applied bool `json:"applied"`
+	Version int  `json:"version"`
+}
+
+type NodeSnapshotRes struct {
+	Path string `json:"path"`
+}
+
+// PendingWrite is a value that has been pre-committed at an address but not yet confirmed
+type PendingWrite struct {
+	Address   string    `json:"address"`
+	Value     string    `json:"value"`
+	WriteID   string    `json:"writeId"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type NodeStateRes struct {
+	ValueVersion  ValueVersion  `json:"valueVersion"`
+	Pending       *PendingWrite `json:"pending"`
+	ShouldInclude bool          `json:"shouldInclude"`
+}
+
+type NodePendingRes struct {
+	Pending []PendingWrite `json:"pending"`
+}
+
+type NodeStatusRes struct {
+	ID          int `json:"id"`
+	TotalNodes  int `json:"totalNodes"`
+	NumReplicas int `json:"numReplicas"`
+	// Addresses is how many addresses the node stores, and Pending how many of them
+	// have a pending value
+	Addresses int `json:"addresses"`
+	Pending   int `json:"pending"`
+}
+
+// NodeDumpRes holds the state of every address a node stores, keyed by address
+type NodeDumpRes struct {
+	States map[string]NodeStateRes `json:"states"`
+}
+
+// NodeFlags are the testing flags that can be toggled on a running node
+type NodeFlags struct {
+	RefuseRead    bool `json:"refuseRead"`
+	RefuseWrite   bool `json:"refuseWrite"`
+	RefuseConfirm bool `json:"refuseConfirm"`
+	RefuseAbort   bool `json:"refuseAbort"`
+	RefuseUpdate  bool `json:"refuseUpdate"`
+}
@@ -0,0 +1,30 @@
+package shared
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateURL(t *testing.T) {
+	assert.Equal(t, "http://localhost:8080/read", CreateURL("localhost:8080", "/read"))
+	assert.Equal(t, "http://10.0.0.2:8080/read", CreateURL("http://10.0.0.2:8080", "/read"))
+	assert.Equal(t, "https://node1.example.com/read", CreateURL("https://node1.example.com/", "/read"))
+}
+
+func TestNodePort(t *testing.T) {
+	port, err := NodePort("node1:8080")
+	assert.Nil(t, err)
+	assert.Equal(t, 8080, port)
+
+	port, err = NodePort("https://node1.example.com:8443")
+	assert.Nil(t, err)
+	assert.Equal(t, 8443, port)
+
+	_, err = NodePort("https://node1.example.com")
+	assert.NotNil(t, err)
+	_, err = NodePort("8080")
+	assert.NotNil(t, err)
+	_, err = NodePort("ftp://node1:8080")
+	assert.NotNil(t, err)
+}
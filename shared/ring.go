@@ -51,3 +51,17 @@ func HashAndCheckShardInclusion(addr string, shard, numShards, numReplicas int)
 	log.Printf("Hashing address %s, result is %v, primary shard %d, current shard %d, numReplicas %d, should include %v", addr, h, int(h)%numShards, shard, numReplicas, res)
 	return res
 }
+
+// ReplicaShards returns the shards addr is stored on, in ascending order.
+// It agrees with HashAndCheckShardInclusion for every shard.
+func ReplicaShards(addr string, numShards, numReplicas int) []int {
+	h := hash(addr)
+
+	var shards []int
+	for shard := 0; shard < numShards; shard++ {
+		if includeInShard(h, shard, numShards, numReplicas) {
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
@@ -17,3 +17,19 @@ func TestIncludeInShard(t *testing.T) {
 	assert.False(t, includeInShard(2, 1, 3, 2))
 	assert.False(t, includeInShard(4, 1, 5, 2))
 }
+
+func TestReplicaShards(t *testing.T) {
+	// hash(addr1) = 1443559033, 1443559033 % 3 = 1
+	assert.Equal(t, []int{1, 2}, ReplicaShards("addr1", 3, 2))
+	assert.Equal(t, []int{0, 1, 2}, ReplicaShards("addr1", 3, 3))
+	assert.Equal(t, []int{1}, ReplicaShards("addr1", 3, 1))
+
+	shards := ReplicaShards("addr1", 5, 3)
+	for shard := 0; shard < 5; shard++ {
+		if HashAndCheckShardInclusion("addr1", shard, 5, 3) {
+			assert.Contains(t, shards, shard)
+		} else {
+			assert.NotContains(t, shards, shard)
+		}
+	}
+}
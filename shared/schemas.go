@@ -4,4 +4,24 @@ package shared
 type ValueVersion struct {
 	Value   string
 	Version int
+	// WriteID identifies the write that confirmed the value, and starts with its writer's client ID.
+	// Two writes can confirm the same version on different majorities once a pending value times
+	// out, and WriteID breaks the tie between them.
+	WriteID string `json:",omitempty"`
+	// Timestamp is when the value was committed, on the writer's hybrid logical clock. Every
+	// replica stores the same timestamp for a write.
+	Timestamp Timestamp
+}
+
+// Newer reports whether vv comes after other. Values are ordered by version, values with the
+// same version by timestamp, so a write that saw another write comes after it, and then by
+// write ID, so every replica and client orders them the same way.
+func (vv ValueVersion) Newer(other ValueVersion) bool {
+	if vv.Version != other.Version {
+		return vv.Version > other.Version
+	}
+	if vv.Timestamp != other.Timestamp {
+		return other.Timestamp.Before(vv.Timestamp)
+	}
+	return vv.WriteID > other.WriteID
 }
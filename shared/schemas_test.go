@@ -0,0 +1,30 @@
+package shared
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueVersionOrder(t *testing.T) {
+	v1 := ValueVersion{Value: "val1", Version: 1, WriteID: "b-1"}
+	v2 := ValueVersion{Value: "val2", Version: 2, WriteID: "a-1"}
+	tie := ValueVersion{Value: "val3", Version: 1, WriteID: "c-1"}
+
+	assert.True(t, v2.Newer(v1))
+	assert.False(t, v1.Newer(v2))
+
+	// The same version is ordered by write ID
+	assert.True(t, tie.Newer(v1))
+	assert.False(t, v1.Newer(tie))
+	assert.True(t, v2.Newer(tie))
+
+	// The same version is ordered by timestamp before write ID
+	later := ValueVersion{Value: "val4", Version: 1, WriteID: "a-2", Timestamp: Timestamp{WallTime: 1}}
+	assert.True(t, later.Newer(tie))
+	assert.False(t, tie.Newer(later))
+
+	// A value isn't newer than itself, and any write is newer than no write
+	assert.False(t, v1.Newer(v1))
+	assert.True(t, v1.Newer(ValueVersion{Version: 1}))
+}